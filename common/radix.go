@@ -2,6 +2,8 @@ package common
 
 import (
 	"fmt"
+	"iter"
+	"slices"
 	"strings"
 )
 
@@ -15,123 +17,442 @@ func NewRadixTree[T any]() *RadixTree[T] {
 
 type Radix[T any] interface {
 	Find(path string) (T, error)
+	FindWithParams(path string) (T, map[string]string, error)
+	FindPattern(pattern string) (T, error)
 	Insert(path string, data T) error
 	Delete(path string) error
+	Walk() iter.Seq2[string, T]
 	Nodes() int
 }
 
 var ErrNoMatch = fmt.Errorf("no match found")
 var ErrPathAlreadyExists = fmt.Errorf("path already exists")
+var ErrConflictingPath = fmt.Errorf("path conflicts with existing path")
+var ErrInvalidPattern = fmt.Errorf("invalid path pattern")
 
 func (r RadixTree[T]) Find(path string) (T, error) {
-	currNode := r.Node
-	for len(path) > 0 {
-		var err error
-		currNode, path, err = findNextNode(currNode, path)
-		if err != nil {
-			return *new(T), err
-		}
-	}
-	if currNode.HasData {
-		return currNode.Data, nil
+	data, _, err := r.FindWithParams(path)
+	return data, err
+}
+
+// FindWithParams works like Find, but additionally returns the values captured by variable labels on the matched path,
+// keyed by their variable name
+func (r RadixTree[T]) FindWithParams(path string) (T, map[string]string, error) {
+	params := make(map[string]string)
+	node := findNode(r.Node, path, params)
+	if node == nil {
+		return *new(T), nil, ErrNoMatch
 	}
-	return *new(T), ErrNoMatch
+	return node.Data, params, nil
 }
 
-func findNextNode[T any](currNode *RadixTreeNode[T], path string) (*RadixTreeNode[T], string, error) {
+// findNode recursively searches for the node with data matching path. Children are tried in order, so if a more
+// specific edge leads into a dead end, we backtrack and try the less specific ones (e.g. variables after strings).
+func findNode[T any](currNode *RadixTreeNode[T], path string, params map[string]string) *RadixTreeNode[T] {
+	if len(path) == 0 {
+		if currNode.HasData {
+			return currNode
+		}
+		//a catch-all also matches if nothing is left of the path
+		for _, child := range currNode.Children {
+			if cl, ok := child.Label.(RadixTreeCatchAllLabel); ok && child.Node.HasData {
+				params[cl.VariableName] = ""
+				return child.Node
+			}
+		}
+		return nil
+	}
 	for _, child := range currNode.Children {
 		unmatched := child.Label.Matches(path)
-		if unmatched != path {
-			return child.Node, unmatched, nil
+		if unmatched == path {
+			continue
+		}
+		node := findNode(child.Node, unmatched, params)
+		if node == nil {
+			continue
+		}
+		switch l := child.Label.(type) {
+		case RadixTreeVariableLabel:
+			params[l.VariableName] = strings.TrimSuffix(path[:len(path)-len(unmatched)], "/")
+		case RadixTreeCatchAllLabel:
+			params[l.VariableName] = path
 		}
+		return node
 	}
 	//no match found in tree
-	return nil, "", ErrNoMatch
+	return nil
+}
+
+// FindPattern returns the data stored for exactly the given pattern. Unlike Find, variables in the pattern are only
+// matched against variable edges of the same name instead of being treated as path segments.
+func (r RadixTree[T]) FindPattern(pattern string) (T, error) {
+	node, err := findPatternNode(r.Node, pattern)
+	if err != nil {
+		return *new(T), err
+	}
+	if !node.HasData {
+		return *new(T), ErrNoMatch
+	}
+	return node.Data, nil
+}
+
+func findPatternNode[T any](currNode *RadixTreeNode[T], pattern string) (*RadixTreeNode[T], error) {
+	labels, err := ParsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range labels {
+		currNode = findLabelNode(currNode, label)
+		if currNode == nil {
+			return nil, ErrNoMatch
+		}
+	}
+	return currNode, nil
 }
 
+// findLabelNode follows the edges of currNode that together spell out exactly label
+func findLabelNode[T any](currNode *RadixTreeNode[T], label RadixTreeLabel) *RadixTreeNode[T] {
+	sl, ok := label.(RadixTreeStringLabel)
+	if !ok {
+		for _, child := range currNode.Children {
+			if child.Label == label {
+				return child.Node
+			}
+		}
+		return nil
+	}
+	rest := sl.Label
+	for len(rest) > 0 {
+		var next *RadixTreeNode[T]
+		for _, child := range currNode.Children {
+			e, ok := child.Label.(RadixTreeStringLabel)
+			if ok && len(e.Label) > 0 && strings.HasPrefix(rest, e.Label) {
+				next = child.Node
+				rest = rest[len(e.Label):]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		currNode = next
+	}
+	return currNode
+}
+
+// Insert adds data to the tree under path. Path segments starting with a colon (e.g. /users/:id) are inserted as
+// variables that match any single non-empty path segment, a last segment starting with an asterisk
+// (e.g. /static/*filepath) is inserted as a catch-all that matches the whole rest of the path.
 func (r RadixTree[T]) Insert(path string, data T) error {
-	//first, try to find the deepest node that matches our path
+	labels, err := ParsePattern(path)
+	if err != nil {
+		return err
+	}
 	currNode := r.Node
-	for len(path) > 0 {
-		var err error
-		//preserve currNode in case we error out
-		currNodeTemp := currNode
-		pathTemp := path
-		currNode, path, err = findNextNode(currNode, path)
+	for _, label := range labels {
+		switch l := label.(type) {
+		case RadixTreeStringLabel:
+			currNode = insertStringLabel(currNode, l.Label)
+		case RadixTreeVariableLabel:
+			currNode, err = insertVariableLabel(currNode, l)
+		case RadixTreeCatchAllLabel:
+			currNode, err = insertCatchAllLabel(currNode, l)
+		}
 		if err != nil {
-			currNode = currNodeTemp
-			path = pathTemp
-			//can't find anything that matches anymore, so we found the deepest node
-			break
+			return fmt.Errorf("failed inserting %s: %w", path, err)
 		}
 	}
-	if len(path) == 0 {
-		if currNode.HasData {
-			return ErrPathAlreadyExists
-		} else {
-			//simply add data to existing node
-			currNode.Data = data
-			currNode.HasData = true
-			return nil
-		}
+	if currNode.HasData {
+		return ErrPathAlreadyExists
 	}
-	//if children exist, see if any child has a matching prefix and find the longest prefix that still matches
-	if len(currNode.Children) > 0 {
+	currNode.Data = data
+	currNode.HasData = true
+	return nil
+}
+
+// insertStringLabel walks down the string edges of currNode as far as they match label, splitting edges where only
+// a part of their label matches, and returns the node at which label ends
+func insertStringLabel[T any](currNode *RadixTreeNode[T], label string) *RadixTreeNode[T] {
+	for len(label) > 0 {
+		var next *RadixTreeNode[T]
 		for _, child := range currNode.Children {
 			//skip all edges that are variables
 			e, ok := child.Label.(RadixTreeStringLabel)
 			if !ok {
 				continue
 			}
-			matchedPrefix := LongestCommonPrefix(e.Label, path)
+			matchedPrefix := LongestCommonPrefix(e.Label, label)
 			if len(matchedPrefix) == 0 {
 				continue
 			}
-			//we found a match, edit current edge to be the prefix and add two new nodes for the suffixes
-			existingNodeSuffix := strings.TrimPrefix(e.Label, matchedPrefix)
-			newNodeSuffix := strings.TrimPrefix(path, matchedPrefix)
-			if len(newNodeSuffix) == 0 {
-				//existing node will now have data instead of creating an empty "" label edge
-				existingNodeReplacement := RadixTreeNode[T]{child.Node.Data, child.Node.HasData, child.Node.Children}
-				existingEdge := RadixTreeEdge[T]{RadixTreeStringLabel{existingNodeSuffix}, &existingNodeReplacement}
-				newChildren := []*RadixTreeEdge[T]{&existingEdge}
-
-				child.Node.HasData = true
-				child.Node.Data = data
-				child.Node.Children = newChildren
-				//we have to also change the label
-				child.Label = RadixTreeStringLabel{matchedPrefix}
-				return nil
-			} else {
-				//create replacement for current child which will become child of a new node
-				existingNodeReplacement := RadixTreeNode[T]{child.Node.Data, child.Node.HasData, child.Node.Children}
-				//create the new node itself
-				newNode := RadixTreeNode[T]{data, true, []*RadixTreeEdge[T]{}}
-				//override current edge with a new edge
-				existingEdge := RadixTreeEdge[T]{RadixTreeStringLabel{existingNodeSuffix}, &existingNodeReplacement}
-				newEdge := RadixTreeEdge[T]{RadixTreeStringLabel{newNodeSuffix}, &newNode}
-				newChildren := []*RadixTreeEdge[T]{&existingEdge, &newEdge}
-
-				child.Node.HasData = false
-				child.Node.Children = newChildren
+			if len(matchedPrefix) < len(e.Label) {
+				//only part of the edge matches, split it into the common prefix and the existing suffix
+				existingEdge := RadixTreeEdge[T]{RadixTreeStringLabel{strings.TrimPrefix(e.Label, matchedPrefix)}, child.Node}
+				child.Node = &RadixTreeNode[T]{Children: []*RadixTreeEdge[T]{&existingEdge}}
 				child.Label = RadixTreeStringLabel{matchedPrefix}
-				return nil
 			}
+			next = child.Node
+			label = strings.TrimPrefix(label, matchedPrefix)
+			break
+		}
+		if next == nil {
+			//there are either no children, or no child that has a matching prefix
+			//create a new edge from scratch
+			newNode := RadixTreeNode[T]{Children: []*RadixTreeEdge[T]{}}
+			addEdge(currNode, &RadixTreeEdge[T]{RadixTreeStringLabel{label}, &newNode})
+			return &newNode
+		}
+		currNode = next
+	}
+	return currNode
+}
 
+// insertVariableLabel returns the node behind the variable edge of currNode, creating it if necessary. Since a
+// variable matches any segment, two differently named variables at the same position can never both be reached.
+func insertVariableLabel[T any](currNode *RadixTreeNode[T], label RadixTreeVariableLabel) (*RadixTreeNode[T], error) {
+	for _, child := range currNode.Children {
+		vl, ok := child.Label.(RadixTreeVariableLabel)
+		if !ok {
+			continue
 		}
+		if vl.VariableName != label.VariableName {
+			return nil, fmt.Errorf("%w: variable :%s conflicts with existing variable :%s",
+				ErrConflictingPath, label.VariableName, vl.VariableName)
+		}
+		return child.Node, nil
 	}
+	newNode := RadixTreeNode[T]{Children: []*RadixTreeEdge[T]{}}
+	addEdge(currNode, &RadixTreeEdge[T]{label, &newNode})
+	return &newNode, nil
+}
 
-	//there are either no children, or no child that has a matching prefix
-	//create a new edge from scratch
-	newNode := RadixTreeNode[T]{data, true, []*RadixTreeEdge[T]{}}
-	newEdge := RadixTreeEdge[T]{RadixTreeStringLabel{path}, &newNode}
-	currNode.Children = append(currNode.Children, &newEdge)
-	return nil
+// insertCatchAllLabel returns the node behind the catch-all edge of currNode, creating it if necessary
+func insertCatchAllLabel[T any](currNode *RadixTreeNode[T], label RadixTreeCatchAllLabel) (*RadixTreeNode[T], error) {
+	for _, child := range currNode.Children {
+		cl, ok := child.Label.(RadixTreeCatchAllLabel)
+		if !ok {
+			continue
+		}
+		if cl.VariableName != label.VariableName {
+			return nil, fmt.Errorf("%w: catch-all *%s conflicts with existing catch-all *%s",
+				ErrConflictingPath, label.VariableName, cl.VariableName)
+		}
+		return child.Node, nil
+	}
+	newNode := RadixTreeNode[T]{Children: []*RadixTreeEdge[T]{}}
+	addEdge(currNode, &RadixTreeEdge[T]{label, &newNode})
+	return &newNode, nil
 }
 
+// addEdge appends edge to the children of node while keeping the children ordered by match priority
+func addEdge[T any](node *RadixTreeNode[T], edge *RadixTreeEdge[T]) {
+	idx := len(node.Children)
+	for i, child := range node.Children {
+		if labelPriority(child.Label) > labelPriority(edge.Label) {
+			idx = i
+			break
+		}
+	}
+	node.Children = slices.Insert(node.Children, idx, edge)
+}
+
+// labelPriority determines in which order edges are tried when searching, lower values are tried first
+func labelPriority(label RadixTreeLabel) int {
+	switch label.(type) {
+	case RadixTreeStringLabel:
+		return 0
+	case RadixTreeVariableLabel:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// ParsePattern splits a path pattern into the labels it consists of. A segment starting with a colon is a variable,
+// which also swallows the slash that follows it (matching RadixTreeVariableLabel.Matches). The last segment may start
+// with an asterisk to become a catch-all, an unnamed catch-all is stored under the name "*".
+func ParsePattern(pattern string) ([]RadixTreeLabel, error) {
+	labels := make([]RadixTreeLabel, 0)
+	start := 0
+	for i := 0; i < len(pattern); i++ {
+		if (pattern[i] != ':' && pattern[i] != '*') || (i > 0 && pattern[i-1] != '/') {
+			continue
+		}
+		if i > start {
+			labels = append(labels, RadixTreeStringLabel{pattern[start:i]})
+		}
+		if pattern[i] == '*' {
+			name := pattern[i+1:]
+			if strings.Contains(name, "/") {
+				return nil, fmt.Errorf("%w: catch-all must be the last segment in %s", ErrInvalidPattern, pattern)
+			}
+			if name == "" {
+				name = "*"
+			}
+			return append(labels, RadixTreeCatchAllLabel{name}), nil
+		}
+		end := strings.IndexByte(pattern[i:], '/')
+		if end == -1 {
+			end = len(pattern)
+		} else {
+			end += i
+		}
+		name := pattern[i+1 : end]
+		if name == "" {
+			return nil, fmt.Errorf("%w: variable without name in %s", ErrInvalidPattern, pattern)
+		}
+		labels = append(labels, RadixTreeVariableLabel{name})
+		//skip the variable and the slash after it
+		i = end
+		start = end + 1
+	}
+	if start < len(pattern) {
+		labels = append(labels, RadixTreeStringLabel{pattern[start:]})
+	}
+	return labels, nil
+}
+
+// Delete removes the data stored for exactly the given pattern. Edges that are no longer needed are removed and
+// single-child string edges are merged back together, so the tree stays as small as if path had never been inserted.
 func (r RadixTree[T]) Delete(path string) error {
-	//TODO implement me
-	panic("implement me")
+	labels, err := ParsePattern(path)
+	if err != nil {
+		return err
+	}
+	//remember every edge we take, so we can clean up on the way back up
+	type step struct {
+		parent *RadixTreeNode[T]
+		edge   *RadixTreeEdge[T]
+	}
+	steps := make([]step, 0)
+	currNode := r.Node
+	for _, label := range labels {
+		sl, ok := label.(RadixTreeStringLabel)
+		if !ok {
+			edge := findEdge(currNode, func(e *RadixTreeEdge[T]) bool { return e.Label == label })
+			if edge == nil {
+				return ErrNoMatch
+			}
+			steps = append(steps, step{currNode, edge})
+			currNode = edge.Node
+			continue
+		}
+		rest := sl.Label
+		for len(rest) > 0 {
+			edge := findEdge(currNode, func(e *RadixTreeEdge[T]) bool {
+				el, ok := e.Label.(RadixTreeStringLabel)
+				return ok && len(el.Label) > 0 && strings.HasPrefix(rest, el.Label)
+			})
+			if edge == nil {
+				return ErrNoMatch
+			}
+			rest = rest[len(edge.Label.(RadixTreeStringLabel).Label):]
+			steps = append(steps, step{currNode, edge})
+			currNode = edge.Node
+		}
+	}
+	if !currNode.HasData {
+		return ErrNoMatch
+	}
+	currNode.Data = *new(T)
+	currNode.HasData = false
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		parent, edge := steps[i].parent, steps[i].edge
+		node := edge.Node
+		if node.HasData {
+			break
+		}
+		if len(node.Children) == 0 {
+			//edge leads nowhere anymore, remove it and check whether the parent can be cleaned up as well
+			parent.Children = slices.DeleteFunc(parent.Children, func(e *RadixTreeEdge[T]) bool { return e == edge })
+			continue
+		}
+		if len(node.Children) == 1 {
+			mergeEdge(edge)
+		}
+		break
+	}
+	return nil
+}
+
+func findEdge[T any](node *RadixTreeNode[T], pred func(*RadixTreeEdge[T]) bool) *RadixTreeEdge[T] {
+	for _, child := range node.Children {
+		if pred(child) {
+			return child
+		}
+	}
+	return nil
+}
+
+// mergeEdge merges edge with the single edge of the node it leads to, if both are string edges
+func mergeEdge[T any](edge *RadixTreeEdge[T]) {
+	child := edge.Node.Children[0]
+	el, ok := edge.Label.(RadixTreeStringLabel)
+	if !ok {
+		return
+	}
+	cl, ok := child.Label.(RadixTreeStringLabel)
+	if !ok {
+		return
+	}
+	edge.Label = RadixTreeStringLabel{el.Label + cl.Label}
+	edge.Node = child.Node
+}
+
+// Clone returns a deep copy of the tree structure. The data of every node is passed through copyData, so that the
+// copy does not share mutable data with the original, if copyData is nil the data is copied as is.
+func (r RadixTree[T]) Clone(copyData func(T) T) *RadixTree[T] {
+	return &RadixTree[T]{cloneNode(r.Node, copyData)}
+}
+
+func cloneNode[T any](node *RadixTreeNode[T], copyData func(T) T) *RadixTreeNode[T] {
+	clone := &RadixTreeNode[T]{Data: node.Data, HasData: node.HasData, Children: make([]*RadixTreeEdge[T], 0, len(node.Children))}
+	if node.HasData && copyData != nil {
+		clone.Data = copyData(node.Data)
+	}
+	for _, child := range node.Children {
+		clone.Children = append(clone.Children, &RadixTreeEdge[T]{child.Label, cloneNode(child.Node, copyData)})
+	}
+	return clone
+}
+
+// Walk returns an iterator over every pattern stored in the tree together with its data. Patterns are yielded in the
+// order Find tries them, so more specific patterns come before the ones they overlap with.
+func (r RadixTree[T]) Walk() iter.Seq2[string, T] {
+	return func(yield func(string, T) bool) {
+		walkNode(r.Node, "", false, yield)
+	}
+}
+
+// walkNode yields the data of node and its children, prefix is the pattern leading up to node. afterVariable is set if
+// node was reached via a variable label, which swallowed the slash that separates it from the next label.
+func walkNode[T any](node *RadixTreeNode[T], prefix string, afterVariable bool, yield func(string, T) bool) bool {
+	if node.HasData && !yield(prefix, node.Data) {
+		return false
+	}
+	if afterVariable {
+		prefix += "/"
+	}
+	for _, child := range node.Children {
+		var pattern string
+		_, isVariable := child.Label.(RadixTreeVariableLabel)
+		switch label := child.Label.(type) {
+		case RadixTreeStringLabel:
+			pattern = prefix + label.Label
+		case RadixTreeVariableLabel:
+			pattern = prefix + ":" + label.VariableName
+		case RadixTreeCatchAllLabel:
+			pattern = prefix + "*"
+			if label.VariableName != "*" {
+				pattern += label.VariableName
+			}
+		}
+		if !walkNode(child.Node, pattern, isVariable, yield) {
+			return false
+		}
+	}
+	return true
 }
 
 func (r RadixTree[T]) Nodes() int {
@@ -179,6 +500,11 @@ type RadixTreeVariableLabel struct {
 	VariableName string
 }
 
+// RadixTreeCatchAllLabel matches everything that is left of a path, it is always tried last
+type RadixTreeCatchAllLabel struct {
+	VariableName string
+}
+
 func (sl RadixTreeStringLabel) Matches(path string) string {
 	//return sl.Label == path
 	if strings.HasPrefix(path, sl.Label) {
@@ -190,9 +516,18 @@ func (sl RadixTreeStringLabel) Matches(path string) string {
 // Matches for a variable label should match anything up to the next slash (or end of stream)
 func (vl RadixTreeVariableLabel) Matches(path string) string {
 	splits := strings.SplitN(path, "/", 2)
+	if splits[0] == "" {
+		//variables never match empty segments
+		return path
+	}
 	if len(splits) == 1 {
 		return ""
 	} else {
 		return splits[1]
 	}
 }
+
+// Matches for a catch-all label swallows the rest of the path
+func (cl RadixTreeCatchAllLabel) Matches(path string) string {
+	return ""
+}
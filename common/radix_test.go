@@ -1,6 +1,9 @@
 package common
 
 import (
+	"errors"
+	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -244,3 +247,221 @@ func TestRadixTree_InsertCreatesNoEdgeWithEmptyString(t *testing.T) {
 		}
 	}
 }
+
+func TestRadixTree_InsertVariables(t *testing.T) {
+	tree := NewRadixTree[int]()
+
+	inserts := []struct {
+		path     string
+		data     int
+		expected error
+	}{
+		{path: "/users/:id", data: 1, expected: nil},
+		{path: "/users/:id/posts/:postId", data: 2, expected: nil},
+		{path: "/users/new", data: 3, expected: nil},
+		{path: "/users/:id/posts", data: 4, expected: nil},
+		{path: "/users/:name", data: 5, expected: ErrConflictingPath},
+		{path: "/users/:id/", data: 6, expected: ErrPathAlreadyExists},
+		{path: "/users/:/posts", data: 7, expected: ErrInvalidPattern},
+	}
+	for _, test := range inserts {
+		err := tree.Insert(test.path, test.data)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("Insert(%q, %d): expected error %v, got %v", test.path, test.data, test.expected, err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		expected int
+		params   map[string]string
+	}{
+		{"/users/42", 1, map[string]string{"id": "42"}},
+		{"/users/42/", 1, map[string]string{"id": "42"}},
+		{"/users/new", 3, map[string]string{}},
+		{"/users/newer", 1, map[string]string{"id": "newer"}},
+		{"/users/42/posts", 4, map[string]string{"id": "42"}},
+		{"/users/42/posts/7", 2, map[string]string{"id": "42", "postId": "7"}},
+		{"/users/new/posts/7", 2, map[string]string{"id": "new", "postId": "7"}},
+		{"/users/", -1, nil},
+		{"/users//posts", -1, nil},
+		{"/users/42/comments", -1, nil},
+	}
+	for _, test := range tests {
+		data, params, err := tree.FindWithParams(test.path)
+		if err != nil {
+			if test.expected != -1 {
+				t.Errorf("unexpected error for path %s: %v", test.path, err)
+			}
+			continue
+		}
+		if data != test.expected {
+			t.Errorf("expected %d for path %s, got %d", test.expected, test.path, data)
+		}
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("expected params %v for path %s, got %v", test.params, test.path, params)
+		}
+	}
+}
+
+func TestRadixTree_FindPattern(t *testing.T) {
+	tree := NewRadixTree[int]()
+	_ = tree.Insert("/users/:id", 1)
+	_ = tree.Insert("/users/new", 2)
+
+	tests := []struct {
+		pattern  string
+		expected int
+	}{
+		{"/users/:id", 1},
+		{"/users/new", 2},
+		{"/users/:name", -1},
+		{"/users/42", -1},
+		{"/users/", -1},
+	}
+	for _, test := range tests {
+		data, err := tree.FindPattern(test.pattern)
+		if err != nil {
+			if test.expected != -1 {
+				t.Errorf("unexpected error for pattern %s: %v", test.pattern, err)
+			}
+		} else if data != test.expected {
+			t.Errorf("expected %d for pattern %s, got %d", test.expected, test.pattern, data)
+		}
+	}
+}
+
+func TestRadixTree_InsertCatchAll(t *testing.T) {
+	tree := NewRadixTree[int]()
+
+	inserts := []struct {
+		path     string
+		data     int
+		expected error
+	}{
+		{path: "/static/*filepath", data: 1, expected: nil},
+		{path: "/static/index.html", data: 2, expected: nil},
+		{path: "/static/:file", data: 3, expected: nil},
+		{path: "/api/*", data: 4, expected: nil},
+		{path: "/static/*other", data: 5, expected: ErrConflictingPath},
+		{path: "/files/*filepath/meta", data: 6, expected: ErrInvalidPattern},
+	}
+	for _, test := range inserts {
+		err := tree.Insert(test.path, test.data)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("Insert(%q, %d): expected error %v, got %v", test.path, test.data, test.expected, err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		expected int
+		params   map[string]string
+	}{
+		{"/static/index.html", 2, map[string]string{}},
+		{"/static/style.css", 3, map[string]string{"file": "style.css"}},
+		{"/static/css/style.css", 1, map[string]string{"filepath": "css/style.css"}},
+		{"/static/", 1, map[string]string{"filepath": ""}},
+		{"/api/v1/users", 4, map[string]string{"*": "v1/users"}},
+		{"/static", -1, nil},
+		{"/files/a", -1, nil},
+	}
+	for _, test := range tests {
+		data, params, err := tree.FindWithParams(test.path)
+		if err != nil {
+			if test.expected != -1 {
+				t.Errorf("unexpected error for path %s: %v", test.path, err)
+			}
+			continue
+		}
+		if data != test.expected {
+			t.Errorf("expected %d for path %s, got %d", test.expected, test.path, data)
+		}
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("expected params %v for path %s, got %v", test.params, test.path, params)
+		}
+	}
+}
+
+func TestRadixTree_Delete(t *testing.T) {
+	tree := NewRadixTree[int]()
+	for i, path := range []string{"home/", "home/about/", "home/contact/", "api/users/", "api/products/", "api/:id", "files/*path"} {
+		if err := tree.Insert(path, i); err != nil {
+			t.Fatalf("Insert(%q): unexpected error %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		path      string
+		expected  error
+		nodes     int
+		remaining []string
+	}{
+		{path: "home/contact/", expected: nil, nodes: 8, remaining: []string{"home/", "home/about/"}},
+		{path: "home/contact/", expected: ErrNoMatch, nodes: 8, remaining: []string{"home/about/"}},
+		{path: "home/", expected: nil, nodes: 7, remaining: []string{"home/about/", "api/users/"}},
+		{path: "api/", expected: ErrNoMatch, nodes: 7, remaining: []string{"api/users/"}},
+		{path: "api/:name", expected: ErrNoMatch, nodes: 7, remaining: []string{"api/:id"}},
+		{path: "api/:id", expected: nil, nodes: 6, remaining: []string{"api/users/", "api/products/"}},
+		{path: "api/users/", expected: nil, nodes: 4, remaining: []string{"api/products/"}},
+		{path: "files/*path", expected: nil, nodes: 2, remaining: []string{"home/about/", "api/products/"}},
+		{path: "home/about/", expected: nil, nodes: 1, remaining: []string{"api/products/"}},
+		{path: "api/products/", expected: nil, nodes: 0, remaining: []string{}},
+	}
+
+	for _, test := range tests {
+		err := tree.Delete(test.path)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("Delete(%q): expected error %v, got %v", test.path, test.expected, err)
+		}
+		if _, err := tree.FindPattern(test.path); err == nil {
+			t.Errorf("FindPattern(%q): expected path to be gone after deletion", test.path)
+		}
+		for _, path := range test.remaining {
+			if _, err := tree.FindPattern(path); err != nil {
+				t.Errorf("FindPattern(%q): unexpected error after deleting %q: %v", path, test.path, err)
+			}
+		}
+		//assert tree has correct amount of nodes
+		if tree.Nodes() != test.nodes {
+			t.Errorf("Delete(%q): expected %d nodes, found %d", test.path, test.nodes, tree.Nodes())
+		}
+	}
+}
+
+func TestRadixTree_Walk(t *testing.T) {
+	tree := NewRadixTree[int]()
+	patterns := []string{"/", "/users/:id/posts/:postId", "/users/:id", "/users/new", "/static/*filepath", "/api/*", "/users"}
+	for i, pattern := range patterns {
+		if err := tree.Insert(pattern, i); err != nil {
+			t.Fatalf("failed inserting %s: %v", pattern, err)
+		}
+	}
+
+	got := make(map[string]int)
+	var order []string
+	for pattern, data := range tree.Walk() {
+		got[pattern] = data
+		order = append(order, pattern)
+	}
+	for i, pattern := range patterns {
+		if data, ok := got[pattern]; !ok || data != i {
+			t.Errorf("expected Walk to yield %s with %d, got %v", pattern, i, got)
+		}
+		//every yielded pattern must lead back to the same node
+		if data, err := tree.FindPattern(pattern); err != nil || data != i {
+			t.Errorf("FindPattern(%s) = %d, %v, want %d", pattern, data, err, i)
+		}
+	}
+	if len(got) != len(patterns) {
+		t.Errorf("expected %d patterns, got %v", len(patterns), order)
+	}
+	if slices.Index(order, "/users/new") > slices.Index(order, "/users/:id") {
+		t.Errorf("expected static patterns before variables, got %v", order)
+	}
+
+	//stopping early must not panic
+	for range tree.Walk() {
+		break
+	}
+}
@@ -1,7 +1,32 @@
 package common
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+const httpDateFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// obsolete date formats recipients must still accept (RFC 9110 section 5.6.7)
+var obsoleteHttpDateFormats = []string{
+	"Monday, 02-Jan-06 15:04:05 GMT",
+	"Mon Jan _2 15:04:05 2006",
+}
 
 func ToHttpDateFormat(t time.Time) string {
-	return t.UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")
+	return t.UTC().Format(httpDateFormat)
+}
+
+// FromHttpDateFormat parses an HTTP date in the preferred IMF-fixdate format or one of the obsolete formats
+func FromHttpDateFormat(s string) (time.Time, error) {
+	t, err := time.Parse(httpDateFormat, s)
+	if err == nil {
+		return t, nil
+	}
+	for _, format := range obsoleteHttpDateFormats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid HTTP date %q", s)
 }
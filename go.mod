@@ -3,6 +3,6 @@ module gophttp
 go 1.24
 
 require (
-	github.com/andybalholm/brotli v1.1.1 // indirect
-	github.com/cbroglie/mustache v1.4.0 // indirect
+	github.com/andybalholm/brotli v1.1.1
+	github.com/cbroglie/mustache v1.4.0
 )
@@ -16,7 +16,7 @@ func BadRequestHandler(ctx http.Context) error {
 	}
 	ctx.Response.Body = body
 	ctx.Response.AddHeader(http.Header{
-		Name:  "MIME",
+		Name:  "Content-Type",
 		Value: "text/plain",
 	})
 	ctx.Response.AddHeader(http.Header{
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/andybalholm/brotli"
 	"gophttp/http"
+	"io"
 	"strconv"
 )
 
@@ -19,7 +20,7 @@ func NewBrotliHandler(quality int) Handler {
 var ErrUnknownBodyType = fmt.Errorf("unknown body type")
 
 func (b brotliHandler) HandleRequest(ctx http.Context) error {
-	if !reqAcceptsBrotli(ctx.Request) {
+	if !reqAcceptsEncoding(ctx.Request, string(BrotliCompression)) || ctx.Response.Body == nil {
 		return nil
 	}
 
@@ -28,11 +29,7 @@ func (b brotliHandler) HandleRequest(ctx http.Context) error {
 		if err != nil {
 			return err
 		}
-	} else { //NOT a channel, do normal stuff
-		bbuf, err := castBody(ctx.Response.Body)
-		if err != nil {
-			return err
-		}
+	} else if bbuf, ok := inMemoryBody(ctx.Response.Body); ok {
 		newBuf, err := b.compressBody(bbuf)
 		if err != nil {
 			ctx.Response.AddHeader(http.Header{
@@ -41,15 +38,20 @@ func (b brotliHandler) HandleRequest(ctx http.Context) error {
 			})
 			return err
 		}
-		//assign body to response
+		//assign body to response, its length is recomputed from the compressed body
 		ctx.Response.Body = newBuf
+		ctx.Response.Headers.Del("Content-Length")
+	} else { //streamed bodies like files are compressed while they are sent, so they never sit in memory as a whole
+		body, err := compressStream(ctx.Response.Body, b.newWriter)
+		if err != nil {
+			return err
+		}
+		//the compressed length isn't known up front, so the body is sent chunked
+		ctx.Response.Body = body
+		ctx.Response.Headers.Del("Content-Length")
 	}
 
-	//set compression header
-	ctx.Response.AddHeader(http.Header{
-		Name:  "Content-Encoding",
-		Value: "br",
-	})
+	setContentEncoding(ctx, BrotliCompression)
 	return nil
 }
 
@@ -57,10 +59,7 @@ func (b brotliHandler) handleChannel(ctx http.Context, c chan http.StreamedRespo
 	tChan := make(chan http.StreamedResponseChunk, 1)
 	ctx.Response.Body = tChan
 	var newBuf bytes.Buffer
-	writer := brotli.NewWriterOptions(&newBuf, brotli.WriterOptions{
-		Quality: b.quality,
-		LGWin:   0,
-	})
+	writer := b.newWriter(&newBuf)
 	go func() {
 		defer close(tChan)
 		for chunk := range c {
@@ -86,30 +85,41 @@ func (b brotliHandler) handleChannel(ctx http.Context, c chan http.StreamedRespo
 	return nil
 }
 
-func reqAcceptsBrotli(request *http.Request) bool {
-	if !request.Headers.HasHeader("Accept-Encoding") {
+// reqAcceptsEncoding reports whether the Accept-Encoding header of request allows encoding, see http.EncodingQValue
+func reqAcceptsEncoding(request *http.Request, encoding string) bool {
+	if !request.Headers.Has("Accept-Encoding") {
 		return false
 	}
-	header := request.Headers["Accept-Encoding"]
-	encodings, err := http.ParseAcceptedQValues(header.Value)
+	encodings, err := http.ParseAcceptedQValues(request.Headers.Combined("Accept-Encoding"))
 	if err != nil {
 		return false
 	}
-	for s := range encodings {
-		if s == "br" {
-			return true
-		}
+	return http.EncodingQValue(encodings, encoding) > 0
+}
+
+// setContentEncoding marks the response as compressed with algorithm
+func setContentEncoding(ctx http.Context, algorithm CompressionAlgorithm) {
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Content-Encoding",
+		Value: string(algorithm),
+	})
+	//the compressed bytes differ from the ones a strong ETag was computed for
+	if ctx.Response.Headers.Has("ETag") {
+		ctx.Response.AddHeader(http.Header{Name: "ETag", Value: http.WeakETag(ctx.Response.Headers.Get("ETag"))})
 	}
-	return false
 }
 
-func (b brotliHandler) compressBody(body []byte) ([]byte, error) {
-	var newBuf bytes.Buffer
-	//create brotli writer that writes into the response buffer
-	writer := brotli.NewWriterOptions(&newBuf, brotli.WriterOptions{
+func (b brotliHandler) newWriter(w io.Writer) io.WriteCloser {
+	return brotli.NewWriterOptions(w, brotli.WriterOptions{
 		Quality: b.quality,
 		LGWin:   0,
 	})
+}
+
+func (b brotliHandler) compressBody(body []byte) ([]byte, error) {
+	var newBuf bytes.Buffer
+	//create brotli writer that writes into the response buffer
+	writer := b.newWriter(&newBuf)
 	_, err := writer.Write(body)
 	if err != nil {
 		return nil, fmt.Errorf("error writing compressed body: %v", err)
@@ -121,16 +131,41 @@ func (b brotliHandler) compressBody(body []byte) ([]byte, error) {
 	return newBuf.Bytes(), nil
 }
 
-func castBody(body interface{}) ([]byte, error) {
-	var bbuf []byte
-	var ok bool
-	//copy old buffer
-	if bbuf, ok = body.([]byte); !ok {
-		if s, ok := body.(string); ok {
-			bbuf = []byte(s)
+// inMemoryBody returns the content of body if it is held in memory already, so it can be compressed in one go
+func inMemoryBody(body interface{}) ([]byte, bool) {
+	switch v := body.(type) {
+	case []byte:
+		return v, true
+	case string:
+		return []byte(v), true
+	case bytes.Buffer:
+		return v.Bytes(), true
+	}
+	return nil, false
+}
+
+// compressStream returns a body yielding body compressed with a writer created by newWriter. The compression runs
+// in the background while the returned body is read, so only a small window of body is held in memory at a time.
+// body is closed once it is compressed, or when the returned body is closed before that.
+func compressStream(body interface{}, newWriter func(w io.Writer) io.WriteCloser) (io.ReadCloser, error) {
+	r, err := http.BodyReader(body)
+	if err != nil {
+		return nil, ErrUnknownBodyType
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		if c, ok := body.(io.Closer); ok {
+			defer c.Close()
+		}
+		writer := newWriter(pw)
+		//writes fail as soon as the reading side is closed, e.g. because the client went away
+		_, err := io.Copy(writer, r)
+		if err == nil {
+			err = writer.Close()
 		} else {
-			return nil, ErrUnknownBodyType
+			err = fmt.Errorf("error writing compressed body: %w", err)
 		}
-	}
-	return bbuf, nil
+		_ = pw.CloseWithError(err)
+	}()
+	return pr, nil
 }
@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
 	"gophttp/http"
+	"io"
 	"log/slog"
+	"maps"
 )
 
 //go:generate stringer -type=CompressionAlgorithm
@@ -11,47 +16,127 @@ type CompressionAlgorithm string
 const (
 	IdentityCompression CompressionAlgorithm = "identity"
 	BrotliCompression   CompressionAlgorithm = "br"
+	GzipCompression     CompressionAlgorithm = "gzip"
+	DeflateCompression  CompressionAlgorithm = "deflate"
 )
 
+// compressions holds the handlers of every supported algorithm at its default level
 var compressions = map[CompressionAlgorithm]Handler{
 	IdentityCompression: IdentityHandler{},
 	BrotliCompression:   NewBrotliHandler(4),
+	GzipCompression:     NewGzipHandler(gzip.DefaultCompression),
+	DeflateCompression:  NewDeflateHandler(zlib.DefaultCompression),
+}
+
+// defaultCompressionPreference is the order in which algorithms are preferred when a client accepts several of them
+// equally
+var defaultCompressionPreference = []CompressionAlgorithm{BrotliCompression, GzipCompression, DeflateCompression}
+
+type CompressionOptions struct {
+	// Levels sets the compression level per algorithm, algorithms not listed keep their default level.
+	// Brotli takes qualities from 0 to 11, gzip and deflate levels from compress/flate.
+	Levels map[CompressionAlgorithm]int
+	// Preference lists the algorithms to offer, the first one is preferred when a client accepts several equally.
+	// Algorithms not listed are not used, the default is br, gzip, deflate.
+	Preference []CompressionAlgorithm
+	// Policy decides which responses get compressed, nil means DefaultCompressionPolicy.
+	// Use an empty policy to turn compression off, e.g. for a single route.
+	Policy *CompressionPolicy
 }
 
 type compressionHandler struct {
+	compressions map[CompressionAlgorithm]Handler
+	//preference holds the names of the offered algorithms in the order we prefer them
+	preference []string
+	policy     CompressionPolicy
 }
 
 func (c compressionHandler) HandleRequest(ctx http.Context) error {
-	//check accepted encodings and select appropriate handler(s) accordingly
-	if !ctx.Request.Headers.HasHeader("Accept-Encoding") {
+	//responses of a type we never compress don't depend on Accept-Encoding
+	contentType := ctx.Response.Headers.Get("Content-Type")
+	if contentType != "" && !c.policy.AllowsType(contentType) {
+		return nil
+	}
+	//the response depends on Accept-Encoding whether it ends up compressed or not, so caches must take it into account
+	addVary(ctx.Response.Headers, "Accept-Encoding")
+	//responses without a body (e.g. 304 Not Modified) have nothing to compress, and range responses must stay
+	//byte-exact as the client combines them with other parts of the uncompressed representation
+	if ctx.Response.Body == nil || ctx.Response.Status == http.StatusPartialContent ||
+		ctx.Response.Headers.Has("Content-Range") {
 		return nil
 	}
-	header := ctx.Request.Headers["Accept-Encoding"]
-	acceptedCompressions, err := http.ParseAcceptedQValues(header.Value)
-	if err != nil {
-		return err
+	//without a Content-Type we can't tell whether compression pays off, and small bodies may even grow
+	if contentType == "" || !c.policy.AllowsSize(http.BodyLength(ctx.Response.Body)) {
+		return nil
+	}
+	//a missing header means any coding is acceptable, we don't compress then. A header we can't parse is ignored.
+	var accepted map[string]float64
+	acceptEncoding := ctx.Request.Headers.Combined("Accept-Encoding")
+	if ctx.Request.Headers.Has("Accept-Encoding") {
+		var err error
+		accepted, err = http.ParseAcceptedQValues(acceptEncoding)
+		if err != nil {
+			slog.Debug("ignoring malformed Accept-Encoding header", "err", err, "index", ctx.Index)
+		}
 	}
-	bestFit := getPreferredAvailableCompression(acceptedCompressions)
-	attr := slog.Group("compression", "best_fit", bestFit, "accept_encoding_header", header.Value)
+	bestFit, err := http.NegotiateEncoding(accepted, c.preference)
+	attr := slog.Group("compression", "best_fit", bestFit, "accept_encoding_header", acceptEncoding)
 	slog.Debug(attr.String(), "index", ctx.Index)
-	if h, ok := compressions[bestFit]; ok {
+	if errors.Is(err, http.ErrNotAcceptable) {
+		//only successful responses are replaced, it's better to send an error in a coding the client didn't ask for
+		//than to hide the error
+		if ctx.Response.Status == http.StatusOK {
+			discardBody(ctx.Response.Body)
+			return NotAcceptableHandler(ctx)
+		}
+		return nil
+	}
+	if h, ok := c.compressions[CompressionAlgorithm(bestFit)]; ok {
 		return h.HandleRequest(ctx)
 	}
 	return nil
 }
 
-func getPreferredAvailableCompression(acceptedCompressions map[string]float64) CompressionAlgorithm {
-	retval := IdentityCompression
-	qValue := -1.0
-	for s, f := range acceptedCompressions {
-		if _, ok := compressions[CompressionAlgorithm(s)]; ok && f > qValue {
-			retval = CompressionAlgorithm(s)
-			qValue = f
-		}
+// discardBody releases a response body that won't be sent
+func discardBody(body interface{}) {
+	switch v := body.(type) {
+	case chan http.StreamedResponseChunk:
+		//the producer of a channel body would block forever if nobody received its chunks
+		http.DiscardChannel(v)
+	case io.Closer:
+		_ = v.Close()
 	}
-	return retval
 }
 
 func NewCompressionHandler() Handler {
-	return &compressionHandler{}
+	return NewCompressionHandlerWithOptions(CompressionOptions{})
+}
+
+// NewCompressionHandlerWithOptions creates a compression handler using the levels, preference order and policy in
+// options
+func NewCompressionHandlerWithOptions(options CompressionOptions) Handler {
+	c := &compressionHandler{compressions: maps.Clone(compressions), policy: DefaultCompressionPolicy}
+	if options.Policy != nil {
+		c.policy = *options.Policy
+	}
+	for algorithm, level := range options.Levels {
+		switch algorithm {
+		case BrotliCompression:
+			c.compressions[algorithm] = NewBrotliHandler(level)
+		case GzipCompression:
+			c.compressions[algorithm] = NewGzipHandler(level)
+		case DeflateCompression:
+			c.compressions[algorithm] = NewDeflateHandler(level)
+		}
+	}
+	preference := options.Preference
+	if preference == nil {
+		preference = defaultCompressionPreference
+	}
+	for _, algorithm := range preference {
+		if _, ok := c.compressions[algorithm]; ok && algorithm != IdentityCompression {
+			c.preference = append(c.preference, string(algorithm))
+		}
+	}
+	return c
 }
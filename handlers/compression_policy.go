@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"strings"
+)
+
+// CompressionPolicy decides which responses are worth compressing, based on their Content-Type and size
+type CompressionPolicy struct {
+	// AllowedTypes lists the media types to compress, either exactly (application/json) or as a whole type (text/*).
+	// Responses without a Content-Type are never compressed.
+	AllowedTypes []string
+	// DeniedTypes lists media types that are never compressed, even if AllowedTypes matches them
+	DeniedTypes []string
+	// MinSize is the smallest body in bytes worth compressing, bodies of unknown length are always compressed
+	MinSize int64
+}
+
+// DefaultCompressionPolicy compresses text, JSON, JavaScript, XML and SVG bodies of at least 256 bytes. Server-sent
+// events are excluded, as compression would buffer the stream.
+var DefaultCompressionPolicy = CompressionPolicy{
+	AllowedTypes: []string{
+		"text/*", "application/json", "application/javascript", "application/x-javascript", "application/xml",
+		"image/svg+xml",
+	},
+	DeniedTypes: []string{"text/event-stream"},
+	MinSize:     256,
+}
+
+// AllowsType reports whether responses with the Content-Type contentType may be compressed
+func (p CompressionPolicy) AllowsType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" || matchesMediaType(p.DeniedTypes, mediaType) {
+		return false
+	}
+	return matchesMediaType(p.AllowedTypes, mediaType)
+}
+
+// AllowsSize reports whether a body of length bytes is large enough to be compressed, known is false if the length
+// of the body can't be known in advance
+func (p CompressionPolicy) AllowsSize(length int64, known bool) bool {
+	return !known || length >= p.MinSize
+}
+
+func matchesMediaType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"gophttp/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures which cross-origin requests a CORSHandler allows (see https://fetch.spec.whatwg.org/#http-cors-protocol)
+type CORSOptions struct {
+	// AllowedOrigins lists the origins (e.g. https://example.com) allowed to access resources. An entry may contain
+	// * as wildcard (e.g. https://*.example.com), a single * allows every origin.
+	AllowedOrigins []string
+	// AllowedOriginPatterns allows every origin matching one of the patterns in addition to AllowedOrigins
+	AllowedOriginPatterns []*regexp.Regexp
+	// AllowedMethods lists the methods allowed for cross-origin requests, GET, HEAD and POST if empty
+	AllowedMethods []http.Method
+	// AllowedHeaders lists the request headers clients may send in addition to the CORS-safelisted ones,
+	// a single * allows all headers
+	AllowedHeaders []string
+	// ExposedHeaders lists the response headers scripts may read in addition to the CORS-safelisted ones
+	ExposedHeaders []string
+	// AllowCredentials allows requests with cookies or HTTP authentication
+	AllowCredentials bool
+	// MaxAge is how long the result of a preflight request may be cached, the client's default is used if zero
+	MaxAge time.Duration
+}
+
+// CORSHandler answers CORS preflight requests and adds the CORS headers to all other responses.
+// Use it as the OPTIONS handler of a route and compose it with the other handlers of the route, or use the CORS
+// middleware instead.
+type CORSHandler struct {
+	options        CORSOptions
+	allowAll       bool
+	originPatterns []*regexp.Regexp
+	methods        string
+}
+
+// CORS-safelisted request headers, which never have to be allowed explicitly
+var safelistedHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type"}
+
+func NewCORSHandler(options CORSOptions) *CORSHandler {
+	c := &CORSHandler{options: options, originPatterns: slices.Clone(options.AllowedOriginPatterns)}
+	for _, origin := range options.AllowedOrigins {
+		if origin == "*" {
+			c.allowAll = true
+		} else if strings.Contains(origin, "*") {
+			pattern := strings.ReplaceAll(regexp.QuoteMeta(origin), `\*`, `[^/]*`)
+			c.originPatterns = append(c.originPatterns, regexp.MustCompile("^"+pattern+"$"))
+		}
+	}
+	methods := options.AllowedMethods
+	if len(methods) == 0 {
+		methods = []http.Method{http.GET, http.HEAD, http.POST}
+	}
+	names := make([]string, len(methods))
+	for i, method := range methods {
+		names[i] = method.String()
+	}
+	c.methods = strings.Join(names, ", ")
+	return c
+}
+
+// IsPreflightRequest reports whether r is a CORS preflight request, which asks whether the actual request may be sent
+func IsPreflightRequest(r *http.Request) bool {
+	return r.Method == http.OPTIONS && r.Headers.Has("Origin") && r.Headers.Has("Access-Control-Request-Method")
+}
+
+func (c *CORSHandler) HandleRequest(ctx http.Context) error {
+	if IsPreflightRequest(ctx.Request) {
+		c.handlePreflight(ctx)
+		return nil
+	}
+	if c.dependsOnOrigin() {
+		addVary(ctx.Response.Headers, "Origin")
+	}
+	origin := ctx.Request.Headers.Get("Origin")
+	if origin == "" || !c.originAllowed(origin) {
+		return nil
+	}
+	c.addOriginHeaders(ctx, origin)
+	if len(c.options.ExposedHeaders) > 0 {
+		ctx.Response.AddHeader(http.Header{
+			Name:  "Access-Control-Expose-Headers",
+			Value: strings.Join(c.options.ExposedHeaders, ", "),
+		})
+	}
+	return nil
+}
+
+// handlePreflight answers a preflight request without running any other handler. If the actual request isn't allowed,
+// the CORS headers are left out, which makes the client reject it.
+func (c *CORSHandler) handlePreflight(ctx http.Context) {
+	ctx.Response.Status = http.StatusNoContent
+	addVary(ctx.Response.Headers, "Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers")
+
+	origin := ctx.Request.Headers.Get("Origin")
+	if !c.originAllowed(origin) || !c.methodAllowed(ctx.Request.Headers.Get("Access-Control-Request-Method")) {
+		return
+	}
+	requestedHeaders := ctx.Request.Headers.Combined("Access-Control-Request-Headers")
+	if !c.headersAllowed(requestedHeaders) {
+		return
+	}
+
+	c.addOriginHeaders(ctx, origin)
+	ctx.Response.AddHeader(http.Header{Name: "Access-Control-Allow-Methods", Value: c.methods})
+	if strings.TrimSpace(requestedHeaders) != "" {
+		//the requested headers were checked above, so we can simply allow exactly those
+		ctx.Response.AddHeader(http.Header{Name: "Access-Control-Allow-Headers", Value: requestedHeaders})
+	}
+	if c.options.MaxAge > 0 {
+		ctx.Response.AddHeader(http.Header{
+			Name:  "Access-Control-Max-Age",
+			Value: strconv.Itoa(int(c.options.MaxAge.Seconds())),
+		})
+	}
+}
+
+func (c *CORSHandler) addOriginHeaders(ctx http.Context, origin string) {
+	//a literal * is not allowed for requests with credentials, so the origin has to be echoed then
+	allowOrigin := origin
+	if c.allowAll && !c.options.AllowCredentials {
+		allowOrigin = "*"
+	}
+	ctx.Response.AddHeader(http.Header{Name: "Access-Control-Allow-Origin", Value: allowOrigin})
+	if c.options.AllowCredentials {
+		ctx.Response.AddHeader(http.Header{Name: "Access-Control-Allow-Credentials", Value: "true"})
+	}
+}
+
+// dependsOnOrigin reports whether responses differ depending on the Origin of the request, so caches must keep them apart
+func (c *CORSHandler) dependsOnOrigin() bool {
+	return !c.allowAll || c.options.AllowCredentials
+}
+
+func (c *CORSHandler) originAllowed(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	if slices.Contains(c.options.AllowedOrigins, origin) {
+		return true
+	}
+	for _, pattern := range c.originPatterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORSHandler) methodAllowed(method string) bool {
+	for _, allowed := range strings.Split(c.methods, ", ") {
+		if method == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORSHandler) headersAllowed(requested string) bool {
+	if slices.Contains(c.options.AllowedHeaders, "*") {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		allowed := func(h string) bool { return strings.EqualFold(h, header) }
+		if !slices.ContainsFunc(safelistedHeaders, allowed) && !slices.ContainsFunc(c.options.AllowedHeaders, allowed) {
+			return false
+		}
+	}
+	return true
+}
+
+// addVary adds names to the Vary header of a response, unless they are already listed
+func addVary(headers http.Headers, names ...string) {
+	for _, name := range names {
+		if headers.ContainsToken("Vary", name) {
+			continue
+		}
+		if headers.Has("Vary") {
+			headers.Set("Vary", headers.Combined("Vary")+", "+name)
+		} else {
+			headers.Set("Vary", name)
+		}
+	}
+}
@@ -4,9 +4,8 @@ import (
 	_ "embed"
 	"gophttp/common"
 	"gophttp/http"
-	"os"
+	"path"
 	"slices"
-	"strings"
 )
 import "github.com/cbroglie/mustache"
 
@@ -24,49 +23,52 @@ func init() {
 }
 
 type directoryHandler struct {
-	HtmlPage string
+	Dir string
+	//Files holds the names of the directories and then the files in Dir
+	Files []string
+}
+
+func (d directoryHandler) String() string {
+	return "directory " + d.Dir
 }
 
 func (d directoryHandler) HandleRequest(ctx http.Context) error {
-	ctx.Response.Body = d.HtmlPage
+	//links are built from the path the listing was requested with, so they lead to the routes of the files even if
+	//the routes were added to a group or mounted below a prefix
+	page, err := d.render(ctx.Request.Path)
+	if err != nil {
+		return err
+	}
+	ctx.Response.Body = page
 	ctx.Response.Status = http.StatusOK
 	ctx.Response.AddHeader(http.Header{
-		Name:  "MIME",
+		Name:  "Content-Type",
 		Value: "text/html",
 	})
 	return nil
 }
 
-func NewDirectoryHandler(dirPath string) (Handler, error) {
-	h := directoryHandler{}
+// render builds the listing of the directory, which is reachable via httpPath
+func (d directoryHandler) render(httpPath string) (string, error) {
+	//calculate the http path to the file
+	var filesWithPaths []struct{ Filename, HttpPath string }
+	for _, file := range d.Files {
+		httpP := http.EscapePath(path.Join(httpPath, file))
+		filesWithPaths = append(filesWithPaths, struct{ Filename, HttpPath string }{Filename: file, HttpPath: httpP})
+	}
+	return directoryTemplate.Render(map[string]interface{}{"files": filesWithPaths, "path": httpPath})
+}
 
+// NewDirectoryHandler creates a handler listing the contents of dirPath, the listing is read once up front
+func NewDirectoryHandler(dirPath string) (Handler, error) {
 	//get all directories first, then append all files to the list
 	directories, err := common.DirsInDirectory(dirPath)
 	if err != nil {
 		return nil, err
 	}
-	//build response body once, reuse it on requests
 	files, err := common.FilesInDirectory(dirPath)
 	if err != nil {
 		return nil, err
 	}
-
-	files = slices.Concat(directories, files)
-
-	//calculate the http path to the file
-	var filesWithPaths []struct{ Filename, HttpPath string }
-	for _, file := range files {
-		fp := strings.Join([]string{dirPath, file}, string(os.PathSeparator))
-		httpP := http.GetHttpPathForFilepath(fp)
-		filesWithPaths = append(filesWithPaths, struct{ Filename, HttpPath string }{Filename: file, HttpPath: httpP})
-	}
-
-	page, err := directoryTemplate.Render(map[string]interface{}{"files": filesWithPaths, "path": http.GetHttpPathForFilepath(dirPath)})
-	if err != nil {
-		return nil, err
-	}
-
-	h.HtmlPage = page
-
-	return h, nil
+	return directoryHandler{Dir: dirPath, Files: slices.Concat(directories, files)}, nil
 }
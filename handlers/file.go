@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"gophttp/common"
 	"gophttp/http"
+	"io"
+	"mime/multipart"
+	"net/textproto"
 	"os"
 )
 
@@ -20,20 +26,131 @@ func NewFileHandler(filepath string) Handler {
 	return f
 }
 
+func (f *fileHandler) String() string {
+	return "file " + f.Filepath
+}
+
 func (f *fileHandler) HandleRequest(ctx http.Context) error {
 	//1. write MIME header
-	//2. read file
-	//3. write body into response
+	//2. write validators and evaluate conditional headers against them
+	//3. serve the requested ranges, if any
+	//4. otherwise stream the whole file as body
 	ctx.Response.AddHeader(http.Header{Name: "Content-Type", Value: f.MIME})
 
-	file, err := os.ReadFile(f.Filepath)
+	file, err := os.Open(f.Filepath)
 	if err != nil {
 		ctx.Response.Status = http.StatusInternalServerError
 		return err
 	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		ctx.Response.Status = http.StatusInternalServerError
+		return err
+	}
+	etag := fileETag(info)
+	ctx.Response.AddHeader(http.Header{Name: "ETag", Value: etag})
+	ctx.Response.AddHeader(http.Header{Name: "Last-Modified", Value: common.ToHttpDateFormat(info.ModTime())})
 
-	ctx.Response.Body = file
+	switch status := http.EvaluatePreconditions(ctx.Request, etag, info.ModTime()); status {
+	case http.StatusNotModified:
+		//a 304 has no body, but keeps the validators so the client can update its cache entry
+		_ = file.Close()
+		ctx.Response.Status = status
+		ctx.Response.Headers.Del("Content-Type")
+		return nil
+	case http.StatusPreconditionFailed:
+		_ = file.Close()
+		ctx.Response.Status = status
+		ctx.Response.Body = ""
+		ctx.Response.Headers.Del("Content-Type")
+		return nil
+	}
+
+	ctx.Response.AddHeader(http.Header{Name: "Accept-Ranges", Value: "bytes"})
+	//range requests are only defined for GET, If-Range makes sure we don't combine parts of different file versions
+	if ctx.Request.Method == http.GET && ctx.Request.Headers.Has("Range") &&
+		http.IfRangeMatches(ctx.Request, etag, info.ModTime()) {
+		ranges, err := http.ParseRange(ctx.Request.Headers.Get("Range"), info.Size())
+		if errors.Is(err, http.ErrRangeNotSatisfiable) {
+			_ = file.Close()
+			ctx.Response.Status = http.StatusRangeNotSatisfiable
+			ctx.Response.Body = ""
+			ctx.Response.Headers.Del("Content-Type")
+			ctx.Response.AddHeader(http.Header{Name: "Content-Range", Value: http.UnsatisfiedContentRange(info.Size())})
+			return nil
+		}
+		//a malformed Range header is ignored and the whole file is served
+		if err == nil && len(ranges) > 0 {
+			return f.serveRanges(ctx, file, ranges, info.Size())
+		}
+	}
+
+	//the file is streamed from disk while writing the response and closed afterwards
+	ctx.Response.Body = http.NewSizedReader(file, info.Size())
 	ctx.Response.Status = http.StatusOK
 
 	return nil
 }
+
+// readCloser combines a reader over parts of a file with the file to close after reading
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// serveRanges answers with a 206 containing the given ranges of file, multiple ranges are sent as multipart/byteranges.
+// It takes ownership of file.
+func (f *fileHandler) serveRanges(ctx http.Context, file *os.File, ranges []http.ByteRange, size int64) error {
+	if len(ranges) == 1 {
+		body, err := http.NewFileSection(file, ranges[0].Start, ranges[0].Length)
+		if err != nil {
+			_ = file.Close()
+			ctx.Response.Status = http.StatusInternalServerError
+			return err
+		}
+		ctx.Response.Body = body
+		ctx.Response.AddHeader(http.Header{Name: "Content-Range", Value: ranges[0].ContentRange(size)})
+		ctx.Response.Status = http.StatusPartialContent
+		return nil
+	}
+
+	//only the part headers are generated up front, the parts themselves are streamed from the file in between them
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	readers := make([]io.Reader, 0, 2*len(ranges)+1)
+	var length int64
+	for _, r := range ranges {
+		_, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {f.MIME},
+			"Content-Range": {r.ContentRange(size)},
+		})
+		if err != nil {
+			_ = file.Close()
+			ctx.Response.Status = http.StatusInternalServerError
+			return err
+		}
+		readers = append(readers, bytes.NewReader(bytes.Clone(buf.Bytes())), io.NewSectionReader(file, r.Start, r.Length))
+		length += int64(buf.Len()) + r.Length
+		buf.Reset()
+	}
+	err := mw.Close()
+	if err != nil {
+		_ = file.Close()
+		ctx.Response.Status = http.StatusInternalServerError
+		return err
+	}
+	readers = append(readers, bytes.NewReader(buf.Bytes()))
+	length += int64(buf.Len())
+
+	ctx.Response.Body = http.NewSizedReader(readCloser{io.MultiReader(readers...), file}, length)
+	ctx.Response.AddHeader(http.Header{Name: "Content-Type", Value: "multipart/byteranges; boundary=" + mw.Boundary()})
+	ctx.Response.Status = http.StatusPartialContent
+	return nil
+}
+
+// fileETag derives a strong ETag from the modification time and size of a file, so it changes whenever the file does
+// without having to hash its content
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size())
+}
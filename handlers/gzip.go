@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"gophttp/http"
+	"io"
+)
+
+// flushWriter is a compressing writer that can emit everything written so far without ending the stream
+type flushWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// deflateHandler compresses responses with a DEFLATE based content coding from the standard library.
+// Unlike brotliHandler it compresses channel bodies chunk by chunk, so streamed responses stay streamed.
+type deflateHandler struct {
+	encoding  CompressionAlgorithm
+	newWriter func(w io.Writer) flushWriter
+}
+
+// NewGzipHandler creates a handler compressing responses with gzip at the given level (see compress/gzip), levels
+// outside of the valid range are clamped to it
+func NewGzipHandler(level int) Handler {
+	level = clampDeflateLevel(level)
+	return &deflateHandler{encoding: GzipCompression, newWriter: func(w io.Writer) flushWriter {
+		//the level is valid, so this can't fail
+		writer, _ := gzip.NewWriterLevel(w, level)
+		return writer
+	}}
+}
+
+// NewDeflateHandler creates a handler compressing responses with the deflate content coding at the given level (see
+// compress/flate). As required by HTTP, the compressed data is wrapped in the zlib format.
+func NewDeflateHandler(level int) Handler {
+	level = clampDeflateLevel(level)
+	return &deflateHandler{encoding: DeflateCompression, newWriter: func(w io.Writer) flushWriter {
+		//the level is valid, so this can't fail
+		writer, _ := zlib.NewWriterLevel(w, level)
+		return writer
+	}}
+}
+
+func clampDeflateLevel(level int) int {
+	return min(max(level, flate.HuffmanOnly), flate.BestCompression)
+}
+
+func (d deflateHandler) HandleRequest(ctx http.Context) error {
+	if !reqAcceptsEncoding(ctx.Request, string(d.encoding)) || ctx.Response.Body == nil {
+		return nil
+	}
+
+	if c, ok := ctx.Response.Body.(chan http.StreamedResponseChunk); ok {
+		d.handleChannel(ctx, c)
+	} else if body, ok := inMemoryBody(ctx.Response.Body); ok {
+		compressed, err := d.compressBody(body)
+		if err != nil {
+			return err
+		}
+		//assign body to response, its length is recomputed from the compressed body
+		ctx.Response.Body = compressed
+		ctx.Response.Headers.Del("Content-Length")
+	} else {
+		body, err := compressStream(ctx.Response.Body, func(w io.Writer) io.WriteCloser { return d.newWriter(w) })
+		if err != nil {
+			return err
+		}
+		//the compressed length isn't known up front, so the body is sent chunked
+		ctx.Response.Body = body
+		ctx.Response.Headers.Del("Content-Length")
+	}
+
+	setContentEncoding(ctx, d.encoding)
+	return nil
+}
+
+// handleChannel replaces the channel body with one carrying the compressed data, every chunk is compressed and
+// flushed as soon as it arrives
+func (d deflateHandler) handleChannel(ctx http.Context, c chan http.StreamedResponseChunk) {
+	tChan := make(chan http.StreamedResponseChunk, 1)
+	ctx.Response.Body = tChan
+	go func() {
+		defer close(tChan)
+		var buf bytes.Buffer
+		writer := d.newWriter(&buf)
+		//send passes on what the writer produced so far, the buffer is reused so its bytes have to be copied
+		send := func() {
+			if buf.Len() > 0 {
+				tChan <- http.StreamedResponseChunk{Data: bytes.Clone(buf.Bytes())}
+				buf.Reset()
+			}
+		}
+		for chunk := range c {
+			if chunk.Err != nil {
+				tChan <- chunk
+				return
+			}
+			_, err := writer.Write(chunk.Data)
+			if err == nil {
+				err = writer.Flush()
+			}
+			if err != nil {
+				tChan <- http.StreamedResponseChunk{Err: err}
+				return
+			}
+			send()
+		}
+		err := writer.Close()
+		if err != nil {
+			tChan <- http.StreamedResponseChunk{Err: err}
+			return
+		}
+		send()
+	}()
+}
+
+func (d deflateHandler) compressBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := d.newWriter(&buf)
+	_, err := writer.Write(body)
+	if err != nil {
+		return nil, fmt.Errorf("error writing compressed body: %v", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error closing %s writer: %v", d.encoding, err)
+	}
+	return buf.Bytes(), nil
+}
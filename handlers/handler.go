@@ -1,6 +1,11 @@
 package handlers
 
-import "gophttp/http"
+import (
+	"fmt"
+	"gophttp/http"
+	"reflect"
+	"runtime"
+)
 
 type Handler interface {
 	HandleRequest(ctx http.Context) error
@@ -12,6 +17,20 @@ func (h HandlerFunc) HandleRequest(ctx http.Context) error {
 	return h(ctx)
 }
 
+// String returns the name of the wrapped function
+func (h HandlerFunc) String() string {
+	return runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+}
+
+// Describe returns a short human-readable description of h for listings like the route table. Handlers implementing
+// fmt.Stringer describe themselves, for all others the type is used.
+func Describe(h Handler) string {
+	if s, ok := h.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", h)
+}
+
 type composedHandler struct {
 	h1, h2 Handler
 }
@@ -25,6 +44,8 @@ func (c composedHandler) HandleRequest(ctx http.Context) error {
 	return err
 }
 
+// ComposeHandlers runs h1 and then h2 on the same request, h2 is skipped if h1 fails.
+// Use a Middleware if the second handler needs to wrap the first or stop the chain.
 func ComposeHandlers(h1, h2 Handler) Handler {
 	return composedHandler{h1, h2}
 }
@@ -33,7 +54,23 @@ func NotFoundHandler(ctx http.Context) error {
 	ctx.Response.Status = http.StatusNotFound
 	ctx.Response.Body = "Page doesn't exist"
 	ctx.Response.AddHeader(http.Header{
-		Name:  "MIME",
+		Name:  "Content-Type",
+		Value: "text/plain",
+	})
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Connection",
+		Value: "close",
+	})
+	return nil
+}
+
+// MethodNotAllowedHandler answers requests for a route that exists, but has no handler for the request method.
+// The caller is responsible for setting the Allow header listing the methods of the route.
+func MethodNotAllowedHandler(ctx http.Context) error {
+	ctx.Response.Status = http.StatusMethodNotAllowed
+	ctx.Response.Body = "Method not allowed"
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Content-Type",
 		Value: "text/plain",
 	})
 	ctx.Response.AddHeader(http.Header{
@@ -43,11 +80,111 @@ func NotFoundHandler(ctx http.Context) error {
 	return nil
 }
 
+// OptionsHandler answers OPTIONS requests for routes without their own OPTIONS handler.
+// The caller is responsible for setting the Allow header listing the methods of the route.
+func OptionsHandler(ctx http.Context) error {
+	ctx.Response.Status = http.StatusNoContent
+	return nil
+}
+
+// NotAcceptableHandler answers requests whose Accept-Encoding header excludes every content coding we could send,
+// including identity. The caller is responsible for discarding the body of the response.
+func NotAcceptableHandler(ctx http.Context) error {
+	ctx.Response.Status = http.StatusNotAcceptable
+	ctx.Response.Body = "Not acceptable"
+	//the headers describing the replaced representation don't apply to the error message
+	for _, name := range []string{"Content-Length", "Content-Type", "ETag", "Last-Modified", "Accept-Ranges"} {
+		ctx.Response.Headers.Del(name)
+	}
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Content-Type",
+		Value: "text/plain",
+	})
+	return nil
+}
+
 func InternalServerErrorHandler(ctx http.Context) error {
 	ctx.Response.Status = http.StatusInternalServerError
 	ctx.Response.Body = "Internal server error"
 	ctx.Response.AddHeader(http.Header{
-		Name:  "MIME",
+		Name:  "Content-Type",
+		Value: "text/plain",
+	})
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Connection",
+		Value: "close",
+	})
+	return nil
+}
+
+func PayloadTooLargeHandler(ctx http.Context) error {
+	ctx.Response.Status = http.StatusPayloadTooLarge
+	ctx.Response.Body = "Payload too large"
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Content-Type",
+		Value: "text/plain",
+	})
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Connection",
+		Value: "close",
+	})
+	return nil
+}
+
+// UnsupportedMediaTypeHandler answers requests whose body uses a content coding we can't decode,
+// telling the client which codings we do accept
+func UnsupportedMediaTypeHandler(ctx http.Context) error {
+	ctx.Response.Status = http.StatusUnsupportedMediaType
+	ctx.Response.Body = "Unsupported content encoding"
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Content-Type",
+		Value: "text/plain",
+	})
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Accept-Encoding",
+		Value: http.SupportedContentEncodings,
+	})
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Connection",
+		Value: "close",
+	})
+	return nil
+}
+
+// NotImplementedHandler answers requests whose body uses a transfer coding we can't decode
+func NotImplementedHandler(ctx http.Context) error {
+	ctx.Response.Status = http.StatusNotImplemented
+	ctx.Response.Body = "Unsupported transfer encoding"
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Content-Type",
+		Value: "text/plain",
+	})
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Connection",
+		Value: "close",
+	})
+	return nil
+}
+
+func URITooLongHandler(ctx http.Context) error {
+	ctx.Response.Status = http.StatusURITooLong
+	ctx.Response.Body = "URI too long"
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Content-Type",
+		Value: "text/plain",
+	})
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Connection",
+		Value: "close",
+	})
+	return nil
+}
+
+func RequestHeaderFieldsTooLargeHandler(ctx http.Context) error {
+	ctx.Response.Status = http.StatusRequestHeaderFieldsTooLarge
+	ctx.Response.Body = "Request header fields too large"
+	ctx.Response.AddHeader(http.Header{
+		Name:  "Content-Type",
 		Value: "text/plain",
 	})
 	ctx.Response.AddHeader(http.Header{
@@ -4,13 +4,11 @@ import (
 	"gophttp/http"
 )
 
+// IdentityHandler leaves the response uncompressed. It doesn't set Content-Encoding, since identity is only used in
+// Accept-Encoding and must not appear in Content-Encoding.
 type IdentityHandler struct {
 }
 
 func (i IdentityHandler) HandleRequest(ctx http.Context) error {
-	ctx.Response.AddHeader(http.Header{
-		Name:  "Content-Encoding",
-		Value: "identity",
-	})
 	return nil
 }
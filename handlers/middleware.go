@@ -0,0 +1,84 @@
+package handlers
+
+import "gophttp/http"
+
+// Middleware wraps a handler into another handler. The returned handler may run code before and after calling next,
+// or answer the request itself without calling next at all.
+type Middleware func(next Handler) Handler
+
+// Chain wraps h into all middlewares, the first middleware is the outermost one and thus runs first.
+// The returned handler is described like h, see Describe.
+func Chain(h Handler, middlewares ...Middleware) Handler {
+	if len(middlewares) == 0 {
+		return h
+	}
+	wrapped := h
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		wrapped = middlewares[i](wrapped)
+	}
+	return chainedHandler{Handler: wrapped, inner: h}
+}
+
+// chainedHandler is a handler wrapped into middlewares, which keeps the wrapped handler around to describe itself
+type chainedHandler struct {
+	Handler
+	inner Handler
+}
+
+func (c chainedHandler) String() string {
+	return Describe(c.inner)
+}
+
+// ResponseHeaders adds the headers required on every response (see ResponseHeadersHandler) after next ran, unless
+// next already streamed its response through ctx.Writer
+func ResponseHeaders(next Handler) Handler {
+	return HandlerFunc(func(ctx http.Context) error {
+		err := next.HandleRequest(ctx)
+		if ctx.Writer.Started() {
+			return err
+		}
+		if headerErr := ResponseHeadersHandler(ctx); headerErr != nil {
+			return headerErr
+		}
+		return err
+	})
+}
+
+// Compress compresses the response of next according to the Accept-Encoding header of the request
+func Compress(next Handler) Handler {
+	return compress(next, NewCompressionHandler())
+}
+
+// CompressWith compresses responses like Compress, using the compression levels, preference order and policy in
+// options. Use it to override the compression of single routes.
+func CompressWith(options CompressionOptions) Middleware {
+	compression := NewCompressionHandlerWithOptions(options)
+	return func(next Handler) Handler {
+		return compress(next, compression)
+	}
+}
+
+func compress(next Handler, compression Handler) Handler {
+	return HandlerFunc(func(ctx http.Context) error {
+		err := next.HandleRequest(ctx)
+		if err != nil {
+			return err
+		}
+		return compression.HandleRequest(ctx)
+	})
+}
+
+// CORS answers preflight requests without calling next and adds CORS headers to all other responses,
+// see CORSHandler
+func CORS(options CORSOptions) Middleware {
+	cors := NewCORSHandler(options)
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx http.Context) error {
+			err := cors.HandleRequest(ctx)
+			if err != nil || IsPreflightRequest(ctx.Request) {
+				return err
+			}
+			return next.HandleRequest(ctx)
+		})
+	}
+}
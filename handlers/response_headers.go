@@ -5,6 +5,7 @@ import (
 	"gophttp/common"
 	"gophttp/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -27,28 +28,27 @@ func ResponseHeadersHandler(ctx http.Context) error {
 		Value: common.ToHttpDateFormat(timeFunc()),
 	})
 	_, bodyIsChannel := ctx.Response.Body.(chan http.StreamedResponseChunk)
-	if bodyIsChannel {
+	switch {
+	case bodyIsChannel:
 		//delete content-length, add transfer-encoding: chunked instead
-		delete(ctx.Response.Headers, "Content-Length")
+		ctx.Response.Headers.Del("Content-Length")
 		ctx.Response.AddHeader(http.Header{
 			Name:  "Transfer-Encoding",
 			Value: "chunked",
 		})
-	} else {
-		if !ctx.Response.Headers.HasHeader("Content-Length") {
-			var length int
-			switch v := ctx.Response.Body.(type) {
-			case string:
-				length = len(v)
-			case []byte:
-				length = len(v)
-			default:
-				//TODO: figure out what to do
-				return nil
-			}
+	case !statusAllowsBody(ctx.Response.Status):
+		//these responses never have a body, so they must not announce one
+	case !ctx.Response.Headers.Has("Content-Length") && !ctx.Response.Headers.Has("Transfer-Encoding"):
+		//send bodies with a length known up front with Content-Length, stream all others chunked
+		if length, ok := http.BodyLength(ctx.Response.Body); ok {
 			ctx.Response.AddHeader(http.Header{
 				Name:  "Content-Length",
-				Value: strconv.Itoa(length),
+				Value: strconv.FormatInt(length, 10),
+			})
+		} else {
+			ctx.Response.AddHeader(http.Header{
+				Name:  "Transfer-Encoding",
+				Value: "chunked",
 			})
 		}
 	}
@@ -58,18 +58,18 @@ func ResponseHeadersHandler(ctx http.Context) error {
 }
 
 func tryWriteConnectionHeader(ctx http.Context) {
-	if ctx.Response.Headers.HasHeader("Connection") {
+	if ctx.Response.Headers.Has("Connection") {
 		return
 	}
 	var connHeader http.Header
-	if ctx.Request == nil {
+	if ctx.Request == nil || ctx.Request.Close {
 		connHeader = http.Header{
 			Name:  "Connection",
 			Value: "close",
 		}
 	} else {
-		if h, ok := ctx.Request.Headers["Connection"]; ok {
-			connHeader = h
+		if ctx.Request.Headers.Has("Connection") {
+			connHeader = http.Header{Name: "Connection", Value: ctx.Request.Headers.Combined("Connection")}
 		} else {
 			connHeader = http.Header{Name: "Connection"}
 			if ctx.Request.Version == http.HTTP1_0 {
@@ -83,3 +83,8 @@ func tryWriteConnectionHeader(ctx http.Context) {
 	}
 	ctx.Response.AddHeader(connHeader)
 }
+
+// statusAllowsBody reports whether a response with status may carry a body and therefore needs framing headers
+func statusAllowsBody(status http.Status) bool {
+	return !strings.HasPrefix(string(status), "1") && status != http.StatusNoContent && status != http.StatusNotModified
+}
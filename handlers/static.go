@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"gophttp/common"
+	"gophttp/http"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+type staticDirectoryHandler struct {
+	Root  string
+	Param string
+}
+
+// NewStaticDirectoryHandler creates a handler that serves the file or directory under root named by the path parameter
+// param (usually a catch-all). Files are looked up on every request, so files added to root later are served as well.
+func NewStaticDirectoryHandler(root, param string) Handler {
+	return &staticDirectoryHandler{Root: root, Param: param}
+}
+
+func (s *staticDirectoryHandler) String() string {
+	return "static directory " + s.Root
+}
+
+func (s *staticDirectoryHandler) HandleRequest(ctx http.Context) error {
+	//cleaning the path as if it were absolute makes sure we never leave root via ..
+	rel := path.Clean("/" + ctx.Param(s.Param))
+	fp := filepath.Join(s.Root, filepath.FromSlash(rel))
+
+	info, err := os.Stat(fp)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return NotFoundHandler(ctx)
+		}
+		return err
+	}
+	if info.IsDir() {
+		h, err := NewDirectoryHandler(fp)
+		if err != nil {
+			return err
+		}
+		return h.HandleRequest(ctx)
+	}
+
+	mime, err := common.GetMIMEFromPath(fp)
+	if err != nil {
+		return err
+	}
+	h := &fileHandler{Filepath: fp, MIME: mime}
+	return h.HandleRequest(ctx)
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"fmt"
+	"slices"
+)
+
+// IdentityEncoding is the content coding of an uncompressed response. It is never sent as Content-Encoding.
+const IdentityEncoding = "identity"
+
+var ErrNotAcceptable = fmt.Errorf("no acceptable content coding")
+
+// identityQValue is the q value of identity when a client doesn't mention it, it loses against every listed coding
+const identityQValue = 0.0001
+
+// EncodingQValue returns the q value a client gives to the content coding encoding in accepted, the parsed value of
+// its Accept-Encoding header (see ParseAcceptedQValues). Codings not listed get the q value of the "*" wildcard,
+// identity stays acceptable unless it is excluded explicitly or via "*;q=0" (RFC 9110 section 12.5.3).
+// A q value of 0 means the coding is not acceptable.
+func EncodingQValue(accepted map[string]float64, encoding string) float64 {
+	if q, ok := accepted[encoding]; ok {
+		return q
+	}
+	if q, ok := accepted["*"]; ok {
+		return q
+	}
+	if encoding == IdentityEncoding {
+		return identityQValue
+	}
+	return 0
+}
+
+// NegotiateEncoding selects the content coding of a response from the parsed Accept-Encoding header accepted and
+// the codings the server supports, given in the order the server prefers them. The coding with the highest q value
+// wins, ties go to the coding the server prefers. Identity is always available, but it loses ties against the
+// supported codings. A nil accepted means the request had no Accept-Encoding header, in which case identity is
+// selected. If neither a supported coding nor identity is acceptable, ErrNotAcceptable is returned.
+func NegotiateEncoding(accepted map[string]float64, supported []string) (string, error) {
+	if accepted == nil {
+		return IdentityEncoding, nil
+	}
+	best := ""
+	bestQ := 0.0
+	for _, encoding := range slices.Concat(supported, []string{IdentityEncoding}) {
+		if q := EncodingQValue(accepted, encoding); q > bestQ {
+			best = encoding
+			bestQ = q
+		}
+	}
+	if best == "" {
+		return "", ErrNotAcceptable
+	}
+	return best, nil
+}
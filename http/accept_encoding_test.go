@@ -0,0 +1,50 @@
+package http
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{"br", "gzip", "deflate"}
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		noHeader       bool
+		want           string
+		wantErr        error
+	}{
+		{"No header", "", true, IdentityEncoding, nil},
+		{"Empty header", "", false, IdentityEncoding, nil},
+		{"Single coding", "gzip", false, "gzip", nil},
+		{"Ties go to the server preference", "deflate, gzip, br", false, "br", nil},
+		{"Highest q value wins", "br;q=0.5, gzip;q=0.8", false, "gzip", nil},
+		{"Excluded coding", "br;q=0, gzip;q=0.1", false, "gzip", nil},
+		{"Wildcard", "*", false, "br", nil},
+		{"Wildcard with exclusion", "*;q=0.5, br;q=0", false, "gzip", nil},
+		{"Unsupported codings only", "zstd, compress", false, IdentityEncoding, nil},
+		{"Identity preferred explicitly", "identity, gzip;q=0.5", false, IdentityEncoding, nil},
+		{"Identity loses ties", "identity, deflate", false, "deflate", nil},
+		{"Identity excluded", "identity;q=0", false, "", ErrNotAcceptable},
+		{"Identity excluded with alternative", "identity;q=0, deflate", false, "deflate", nil},
+		{"Everything excluded by wildcard", "*;q=0", false, "", ErrNotAcceptable},
+		{"Wildcard exclusion keeps listed identity", "*;q=0, identity;q=0.1", false, IdentityEncoding, nil},
+		{"Everything excluded", "gzip;q=0, identity;q=0, *;q=0", false, "", ErrNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accepted map[string]float64
+			if !tt.noHeader {
+				var err error
+				accepted, err = ParseAcceptedQValues(tt.acceptEncoding)
+				if err != nil {
+					t.Fatalf("ParseAcceptedQValues() error = %v", err)
+				}
+			}
+			got, err := NegotiateEncoding(accepted, supported)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("NegotiateEncoding() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// maxDrainBytes is the amount of unread body we are willing to discard to keep a connection alive,
+// if more than that is left it is cheaper to close the connection
+const maxDrainBytes = 256 << 10
+
+var ErrBodyReadAfterClose = fmt.Errorf("read on closed request body")
+var ErrBodyNotDrained = fmt.Errorf("request body too large to drain")
+
+type noBody struct{}
+
+func (noBody) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (noBody) Close() error {
+	return nil
+}
+
+// NoBody is the body of requests that don't have one
+var NoBody io.ReadCloser = noBody{}
+
+// body streams a request body from the connection. Closing it discards everything that wasn't read yet,
+// so the underlying reader is positioned at the start of the next request afterwards.
+type body struct {
+	conn net.Conn
+	//src yields the decoded body
+	src io.Reader
+	//framed is the reader that knows where the body ends on the connection
+	framed io.Reader
+	closed bool
+}
+
+func newBody(conn net.Conn, decoded io.Reader, framed io.Reader) *body {
+	return &body{conn: conn, src: decoded, framed: framed}
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyReadAfterClose
+	}
+	//refresh the read deadline on every read, so slow but steady uploads don't time out
+	err := b.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	if err != nil {
+		return 0, err
+	}
+	return b.src.Read(p)
+}
+
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	err := b.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(b.framed, maxDrainBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed draining request body: %w", err)
+	}
+	if n > maxDrainBytes {
+		return ErrBodyNotDrained
+	}
+	return nil
+}
+
+// lengthReader reads exactly n bytes from r and fails if r ends before that
+type lengthReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if err == io.EOF && l.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
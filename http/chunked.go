@@ -0,0 +1,268 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// maxChunkLineLength limits the chunk size line including all chunk extensions
+	maxChunkLineLength = 4096
+	// maxTrailerBytes limits the size of all trailer fields combined
+	maxTrailerBytes = 8192
+	// maxChunkSizeDigits keeps the chunk size within an int64
+	maxChunkSizeDigits = 15
+)
+
+var ErrMalformedChunkedBody = fmt.Errorf("%w: malformed chunked body", ErrInvalidRequest)
+
+// chunkedReader decodes a body sent with Transfer-Encoding: chunked as described in RFC 9112 section 7.1.
+// Chunk extensions are validated and ignored, trailer fields are added to trailers once the last chunk was read.
+type chunkedReader struct {
+	r        *bufio.Reader
+	trailers Headers
+	//bytes left in the current chunk
+	n    int64
+	done bool
+	err  error
+}
+
+func newChunkedReader(r *bufio.Reader, trailers Headers) *chunkedReader {
+	return &chunkedReader{r: r, trailers: trailers}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.n == 0 {
+		c.err = c.nextChunk()
+		if c.err != nil {
+			return 0, c.err
+		}
+		if c.done {
+			return 0, io.EOF
+		}
+	}
+	if int64(len(p)) > c.n {
+		p = p[:c.n]
+	}
+	n, err := c.r.Read(p)
+	c.n -= int64(n)
+	if err == io.EOF {
+		err = fmt.Errorf("%w: body ends in the middle of a chunk", ErrMalformedChunkedBody)
+	}
+	if err == nil && c.n == 0 {
+		err = c.readChunkEnd()
+	}
+	c.err = err
+	return n, err
+}
+
+// nextChunk reads the chunk size line of the next chunk, and the trailer section if it is the last chunk
+func (c *chunkedReader) nextChunk() error {
+	line, err := readChunkLine(c.r, maxChunkLineLength)
+	if err != nil {
+		return err
+	}
+	size, err := parseChunkSizeLine(line)
+	if err != nil {
+		return err
+	}
+	c.n = size
+	if size == 0 {
+		c.done = true
+		return c.readTrailers()
+	}
+	return nil
+}
+
+// readChunkEnd consumes the CRLF that has to follow the data of every chunk
+func (c *chunkedReader) readChunkEnd() error {
+	line, err := readChunkLine(c.r, maxChunkLineLength)
+	if err != nil {
+		return err
+	}
+	if len(line) != 0 {
+		return fmt.Errorf("%w: chunk data longer than chunk size", ErrMalformedChunkedBody)
+	}
+	return nil
+}
+
+func (c *chunkedReader) readTrailers() error {
+	total := 0
+	for {
+		line, err := readChunkLine(c.r, maxTrailerBytes-total)
+		if err != nil {
+			return err
+		}
+		if len(line) == 0 {
+			return nil
+		}
+		total += len(line)
+		name, value, ok := strings.Cut(string(line), ":")
+		if !ok || !isToken(name) {
+			return fmt.Errorf("%w: invalid trailer field %q", ErrMalformedChunkedBody, line)
+		}
+		if c.trailers != nil {
+			c.trailers.Add(name, strings.TrimSpace(value))
+		}
+	}
+}
+
+// readChunkLine reads a line of the chunked framing, see readLine
+func readChunkLine(r *bufio.Reader, maxLen int) ([]byte, error) {
+	line, err := readLine(r, maxLen)
+	switch {
+	case err == nil:
+		return line, nil
+	case errors.Is(err, errLineTooLong):
+		return nil, fmt.Errorf("%w: line exceeds %d bytes", ErrMalformedChunkedBody, maxLen)
+	case errors.Is(err, errBareCR):
+		return nil, fmt.Errorf("%w: bare CR in line", ErrMalformedChunkedBody)
+	case err == io.EOF:
+		return nil, fmt.Errorf("%w: unexpected end of body", ErrMalformedChunkedBody)
+	default:
+		return nil, err
+	}
+}
+
+// parseChunkSizeLine parses chunk-size [ chunk-ext ], where chunk-ext is *( BWS ";" BWS name [ BWS "=" BWS value ] )
+func parseChunkSizeLine(line []byte) (int64, error) {
+	i := 0
+	var size int64
+	for ; i < len(line) && isHexDigit(line[i]); i++ {
+		if i == maxChunkSizeDigits {
+			return 0, fmt.Errorf("%w: chunk size too large", ErrMalformedChunkedBody)
+		}
+		size = size<<4 | int64(hexValue(line[i]))
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedChunkedBody, line)
+	}
+	err := validateChunkExtensions(line[i:])
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func validateChunkExtensions(ext []byte) error {
+	p := extParser{ext, 0}
+	for {
+		p.skipWhitespace()
+		if p.eof() {
+			return nil
+		}
+		if !p.consume(';') {
+			return fmt.Errorf("%w: invalid chunk extension %q", ErrMalformedChunkedBody, ext)
+		}
+		p.skipWhitespace()
+		if p.token() == "" {
+			return fmt.Errorf("%w: chunk extension without name %q", ErrMalformedChunkedBody, ext)
+		}
+		p.skipWhitespace()
+		if !p.consume('=') {
+			continue
+		}
+		p.skipWhitespace()
+		if p.token() == "" && !p.quotedString() {
+			return fmt.Errorf("%w: invalid chunk extension value %q", ErrMalformedChunkedBody, ext)
+		}
+	}
+}
+
+// extParser is a minimal cursor over the chunk extensions of a chunk size line
+type extParser struct {
+	b   []byte
+	pos int
+}
+
+func (p *extParser) eof() bool {
+	return p.pos >= len(p.b)
+}
+
+func (p *extParser) skipWhitespace() {
+	for !p.eof() && (p.b[p.pos] == ' ' || p.b[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *extParser) consume(c byte) bool {
+	if !p.eof() && p.b[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *extParser) token() string {
+	start := p.pos
+	for !p.eof() && isTokenChar(p.b[p.pos]) {
+		p.pos++
+	}
+	return string(p.b[start:p.pos])
+}
+
+func (p *extParser) quotedString() bool {
+	if !p.consume('"') {
+		return false
+	}
+	for !p.eof() {
+		c := p.b[p.pos]
+		p.pos++
+		switch {
+		case c == '"':
+			return true
+		case c == '\\':
+			if p.eof() {
+				return false
+			}
+			p.pos++
+		case c < 0x20 && c != '\t', c == 0x7f:
+			return false
+		}
+	}
+	return false
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTokenChar reports whether c is a tchar as defined in RFC 9110 section 5.6.2
+func isTokenChar(c byte) bool {
+	if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
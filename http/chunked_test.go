@@ -0,0 +1,139 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkedReader(t *testing.T) {
+	bigChunk := strings.Repeat("a", 100000)
+	tests := []struct {
+		name     string
+		input    string
+		want     string
+		trailers Headers
+		wantErr  bool
+	}{
+		{"Single chunk", "5\r\nhello\r\n0\r\n\r\n", "hello", Headers{}, false},
+		{"Multiple chunks", "5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n", "hello world", Headers{}, false},
+		{"Empty body", "0\r\n\r\n", "", Headers{}, false},
+		{"Newlines in chunk data", "c\r\nline1\nline2\n\r\n0\r\n\r\n", "line1\nline2\n", Headers{}, false},
+		{"CRLF in chunk data", "7\r\na\r\nb\r\nc\r\n0\r\n\r\n", "a\r\nb\r\nc", Headers{}, false},
+		{"Chunk larger than scanner buffer", "186a0\r\n" + bigChunk + "\r\n0\r\n\r\n", bigChunk, Headers{}, false},
+		{"Uppercase hex size", "A\r\n0123456789\r\n0\r\n\r\n", "0123456789", Headers{}, false},
+		{"Leading zeros in size", "0005\r\nhello\r\n0000\r\n\r\n", "hello", Headers{}, false},
+		{"Chunk extension", "5;name=value\r\nhello\r\n0\r\n\r\n", "hello", Headers{}, false},
+		{"Chunk extension without value", "5;flag\r\nhello\r\n0;last\r\n\r\n", "hello", Headers{}, false},
+		{"Multiple chunk extensions with whitespace", "5 ; a=1 ;b = 2\r\nhello\r\n0\r\n\r\n", "hello", Headers{}, false},
+		{"Quoted chunk extension", "5;name=\"va;l\\\"ue\"\r\nhello\r\n0\r\n\r\n", "hello", Headers{}, false},
+		{"Bare LF line endings", "5\nhello\n0\n\n", "hello", Headers{}, false},
+		{"Trailers", "5\r\nhello\r\n0\r\nChecksum: abc\r\nExpires: never\r\n\r\n", "hello",
+			Headers{"Checksum": {"abc"}, "Expires": {"never"}}, false},
+		{"Invalid hex size", "xyz\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Negative size", "-5\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Plus sign in size", "+5\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Hex prefix in size", "0x5\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Whitespace before size", " 5\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Empty size line", "\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Size overflow", "fffffffffffffffff\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Chunk data longer than size", "3\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Chunk data shorter than size", "9\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Missing CRLF after data", "5\r\nhello0\r\n\r\n", "", nil, true},
+		{"Bare CR in size line", "5\rx\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Invalid chunk extension", "5;=value\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Garbage after size", "5 garbage\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Unterminated quoted extension", "5;a=\"value\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Size line too long", "5;" + strings.Repeat("a", maxChunkLineLength) + "\r\nhello\r\n0\r\n\r\n", "", nil, true},
+		{"Invalid trailer", "0\r\nno colon here\r\n\r\n", "", nil, true},
+		{"Trailers too large", "0\r\nX-Big: " + strings.Repeat("a", maxTrailerBytes) + "\r\n\r\n", "", nil, true},
+		{"Missing last chunk", "5\r\nhello\r\n", "", nil, true},
+		{"Missing end of trailers", "5\r\nhello\r\n0\r\n", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trailers := Headers{}
+			c := newChunkedReader(bufio.NewReader(strings.NewReader(tt.input)), trailers)
+			got, err := io.ReadAll(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reading chunked body: error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrMalformedChunkedBody) {
+					t.Errorf("expected ErrMalformedChunkedBody, got %v", err)
+				}
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("reading chunked body: got %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(trailers, tt.trailers) {
+				t.Errorf("trailers: got %v, want %v", trailers, tt.trailers)
+			}
+		})
+	}
+}
+
+func TestChunkedReaderLeavesNextRequestUntouched(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("5\r\nhello\r\n0\r\nX-Trailer: 1\r\n\r\nGET / HTTP/1.1\r\n"))
+	_, err := io.ReadAll(newChunkedReader(r, nil))
+	if err != nil {
+		t.Fatalf("reading chunked body: unexpected error %v", err)
+	}
+	rest, _ := io.ReadAll(r)
+	if string(rest) != "GET / HTTP/1.1\r\n" {
+		t.Errorf("expected reader to be positioned at next request, got %q", rest)
+	}
+}
+
+func FuzzChunkedReader(f *testing.F) {
+	f.Add([]byte("5\r\nhello\r\n0\r\n\r\n"))
+	f.Add([]byte("5;a=\"b\"\r\nhello\r\n6\r\n world\r\n0\r\nX: y\r\n\r\n"))
+	f.Add([]byte("fffffffffffffff\r\n"))
+	f.Add([]byte("0\n\n"))
+	f.Fuzz(func(t *testing.T, input []byte) {
+		got, err := io.ReadAll(newChunkedReader(bufio.NewReader(bytes.NewReader(input)), Headers{}))
+		if err != nil {
+			if !errors.Is(err, ErrMalformedChunkedBody) {
+				t.Errorf("unexpected error type: %v", err)
+			}
+			return
+		}
+		if len(got) > len(input) {
+			t.Errorf("decoded body of %d bytes is longer than input of %d bytes", len(got), len(input))
+		}
+	})
+}
+
+func FuzzChunkedReaderRoundTrip(f *testing.F) {
+	f.Add([]byte("hello world"), uint8(3))
+	f.Add([]byte("line1\r\nline2\n"), uint8(1))
+	f.Add([]byte{}, uint8(10))
+	f.Fuzz(func(t *testing.T, data []byte, chunkSize uint8) {
+		size := int(chunkSize) + 1
+		var encoded bytes.Buffer
+		w := bufio.NewWriter(&encoded)
+		for start := 0; start < len(data); start += size {
+			end := min(start+size, len(data))
+			if err := handleChunk(StreamedResponseChunk{Data: data[start:end]}, w); err != nil {
+				t.Fatalf("encoding chunk: %v", err)
+			}
+		}
+		if err := handleChunk(StreamedResponseChunk{Data: []byte{}}, w); err != nil {
+			t.Fatalf("encoding last chunk: %v", err)
+		}
+		_ = w.Flush()
+
+		got, err := io.ReadAll(newChunkedReader(bufio.NewReader(&encoded), Headers{}))
+		if err != nil {
+			t.Fatalf("decoding chunked body: %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("round trip mismatch: got %q, want %q", got, data)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"gophttp/common"
+	"strings"
+	"time"
+)
+
+// EvaluatePreconditions evaluates the conditional headers of r against the current etag and lastModified time of the
+// selected representation in the order defined by RFC 9110 section 13.2.2. It returns StatusOK if the request should be
+// processed normally, StatusNotModified or StatusPreconditionFailed otherwise. An empty etag or a zero lastModified
+// means the representation has no such validator.
+func EvaluatePreconditions(r *Request, etag string, lastModified time.Time) Status {
+	//a Last-Modified date only has a resolution of seconds
+	lastModified = lastModified.Truncate(time.Second)
+
+	if r.Headers.Has("If-Match") {
+		if !matchesETag(r.Headers.Combined("If-Match"), etag, true) {
+			return StatusPreconditionFailed
+		}
+	} else if r.Headers.Has("If-Unmodified-Since") && !lastModified.IsZero() {
+		since, err := common.FromHttpDateFormat(r.Headers.Get("If-Unmodified-Since"))
+		//an invalid date is ignored
+		if err == nil && lastModified.After(since) {
+			return StatusPreconditionFailed
+		}
+	}
+
+	safe := r.Method == GET || r.Method == HEAD
+	if r.Headers.Has("If-None-Match") {
+		if matchesETag(r.Headers.Combined("If-None-Match"), etag, false) {
+			if safe {
+				return StatusNotModified
+			}
+			return StatusPreconditionFailed
+		}
+	} else if safe && r.Headers.Has("If-Modified-Since") && !lastModified.IsZero() {
+		since, err := common.FromHttpDateFormat(r.Headers.Get("If-Modified-Since"))
+		if err == nil && !lastModified.After(since) {
+			return StatusNotModified
+		}
+	}
+	return StatusOK
+}
+
+// WeakETag returns the weak version of etag, e.g. for a representation that was transformed by a content coding
+func WeakETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return "W/" + etag
+}
+
+// matchesETag reports whether the If-Match or If-None-Match field value header contains etag, using the strong
+// comparison if strong is set and the weak comparison otherwise (RFC 9110 section 8.8.3.2)
+func matchesETag(header string, etag string, strong bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if etag == "" {
+		return false
+	}
+	etagWeak, etagOpaque := splitETag(etag)
+	for _, candidate := range parseETagList(header) {
+		weak, opaque := splitETag(candidate)
+		if opaque != etagOpaque {
+			continue
+		}
+		if !strong || (!weak && !etagWeak) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitETag splits etag into its weakness indicator and its opaque tag including the quotes
+func splitETag(etag string) (bool, string) {
+	if opaque, ok := strings.CutPrefix(etag, "W/"); ok {
+		return true, opaque
+	}
+	return false, etag
+}
+
+// parseETagList parses a comma separated list of entity tags. Parsing stops at the first malformed element, as we can't
+// know where the next element starts.
+func parseETagList(s string) []string {
+	var etags []string
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return etags
+		}
+		start := 0
+		if strings.HasPrefix(s, "W/") {
+			start = 2
+		}
+		if len(s) <= start || s[start] != '"' {
+			return etags
+		}
+		end := strings.IndexByte(s[start+1:], '"')
+		if end == -1 {
+			return etags
+		}
+		end += start + 2
+		etags = append(etags, s[:end])
+		s = s[end:]
+	}
+}
+
+// IfRangeMatches reports whether a Range header of r should be evaluated, which is the case if r has no If-Range
+// header or its validator still matches the etag or lastModified time of the representation (RFC 9110 section 13.1.5)
+func IfRangeMatches(r *Request, etag string, lastModified time.Time) bool {
+	if !r.Headers.Has("If-Range") {
+		return true
+	}
+	value := strings.TrimSpace(r.Headers.Get("If-Range"))
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "W/") {
+		//only a strong comparison may be used, so weak tags never match
+		weak, _ := splitETag(value)
+		return !weak && value == etag && !strings.HasPrefix(etag, "W/")
+	}
+	date, err := common.FromHttpDateFormat(value)
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	return lastModified.Truncate(time.Second).Equal(date)
+}
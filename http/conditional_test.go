@@ -0,0 +1,70 @@
+package http
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluatePreconditions(t *testing.T) {
+	etag := `"abc"`
+	lastModified := time.Date(2024, time.March, 10, 12, 0, 0, 500, time.UTC)
+	before := "Sun, 10 Mar 2024 11:59:59 GMT"
+	exact := "Sun, 10 Mar 2024 12:00:00 GMT"
+	tests := []struct {
+		name    string
+		method  Method
+		headers map[string]string
+		want    Status
+	}{
+		{"No conditions", GET, nil, StatusOK},
+		{"If-None-Match matches", GET, map[string]string{"If-None-Match": `"abc"`}, StatusNotModified},
+		{"If-None-Match matches weakly", GET, map[string]string{"If-None-Match": `W/"abc"`}, StatusNotModified},
+		{"If-None-Match in list", HEAD, map[string]string{"If-None-Match": `"x", W/"y,z", "abc"`}, StatusNotModified},
+		{"If-None-Match star", GET, map[string]string{"If-None-Match": "*"}, StatusNotModified},
+		{"If-None-Match differs", GET, map[string]string{"If-None-Match": `"other"`}, StatusOK},
+		{"If-None-Match matches on PUT", PUT, map[string]string{"If-None-Match": `"abc"`}, StatusPreconditionFailed},
+		{"If-None-Match takes precedence", GET, map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": exact}, StatusOK},
+		{"If-Modified-Since same second", GET, map[string]string{"If-Modified-Since": exact}, StatusNotModified},
+		{"If-Modified-Since obsolete format", GET, map[string]string{"If-Modified-Since": "Sunday, 10-Mar-24 12:00:00 GMT"}, StatusNotModified},
+		{"If-Modified-Since asctime format", GET, map[string]string{"If-Modified-Since": "Sun Mar 10 12:00:00 2024"}, StatusNotModified},
+		{"If-Modified-Since before", GET, map[string]string{"If-Modified-Since": before}, StatusOK},
+		{"If-Modified-Since invalid", GET, map[string]string{"If-Modified-Since": "yesterday"}, StatusOK},
+		{"If-Modified-Since on POST", POST, map[string]string{"If-Modified-Since": exact}, StatusOK},
+		{"If-Match matches", PUT, map[string]string{"If-Match": `"abc"`}, StatusOK},
+		{"If-Match star", PUT, map[string]string{"If-Match": "*"}, StatusOK},
+		{"If-Match weak never matches", GET, map[string]string{"If-Match": `W/"abc"`}, StatusPreconditionFailed},
+		{"If-Match differs", GET, map[string]string{"If-Match": `"other"`}, StatusPreconditionFailed},
+		{"If-Match malformed", GET, map[string]string{"If-Match": `abc`}, StatusPreconditionFailed},
+		{"If-Match takes precedence", GET, map[string]string{"If-Match": `"abc"`, "If-Unmodified-Since": before}, StatusOK},
+		{"If-Unmodified-Since before", PUT, map[string]string{"If-Unmodified-Since": before}, StatusPreconditionFailed},
+		{"If-Unmodified-Since same second", PUT, map[string]string{"If-Unmodified-Since": exact}, StatusOK},
+		{"If-Match and If-None-Match", GET, map[string]string{"If-Match": `"abc"`, "If-None-Match": `"abc"`}, StatusNotModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Request{Method: tt.method, Headers: make(Headers)}
+			for name, value := range tt.headers {
+				r.Headers.Set(name, value)
+			}
+			if got := EvaluatePreconditions(r, etag, lastModified); got != tt.want {
+				t.Errorf("EvaluatePreconditions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeakETag(t *testing.T) {
+	tests := []struct {
+		etag string
+		want string
+	}{
+		{`"abc"`, `W/"abc"`},
+		{`W/"abc"`, `W/"abc"`},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := WeakETag(tt.etag); got != tt.want {
+			t.Errorf("WeakETag(%q) = %q, want %q", tt.etag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// MaxDecodedBodySize limits how large a request body may become when decoding its Content-Encoding,
+// this protects handlers from decompression bombs
+var MaxDecodedBodySize int64 = 64 << 20
+
+// SupportedContentEncodings lists all request content codings we are able to decode, in the format of the
+// Accept-Encoding header
+const SupportedContentEncodings = "gzip, deflate, br"
+
+var ErrUnsupportedContentEncoding = fmt.Errorf("unsupported content encoding")
+var ErrMalformedContentEncoding = fmt.Errorf("%w: malformed content encoding", ErrInvalidRequest)
+var ErrBodyTooLarge = fmt.Errorf("request body too large")
+
+var contentDecoders = map[string]func(io.Reader) (io.Reader, error){
+	"gzip":    newGzipDecoder,
+	"x-gzip":  newGzipDecoder,
+	"deflate": newDeflateDecoder,
+	"br":      newBrotliDecoder,
+}
+
+// handleContentEncoding wraps body with decoders for all codings listed in the Content-Encoding header of request.
+// Codings are listed in the order they were applied, so they are decoded in reverse order.
+func handleContentEncoding(body io.Reader, request *Request) (io.Reader, error) {
+	if !request.Headers.Has("Content-Encoding") {
+		return body, nil
+	}
+	codings := strings.Split(request.Headers.Combined("Content-Encoding"), ",")
+	decoded := false
+	for _, coding := range slices.Backward(codings) {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "identity" || coding == "" {
+			continue
+		}
+		newDecoder, ok := contentDecoders[coding]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, coding)
+		}
+		body = &decodingReader{src: body, newDecoder: newDecoder}
+		decoded = true
+	}
+	if !decoded {
+		return body, nil
+	}
+	//the headers describe the encoded body, which handlers never get to see
+	request.Headers.Del("Content-Encoding")
+	request.Headers.Del("Content-Length")
+	return &maxSizeReader{r: body, n: MaxDecodedBodySize}, nil
+}
+
+// decodingReader creates its decoder on the first read, as some decoders already read from src when created and
+// we must not block on the connection before the handler actually wants the body
+type decodingReader struct {
+	src        io.Reader
+	newDecoder func(io.Reader) (io.Reader, error)
+	dec        io.Reader
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	if d.dec == nil {
+		dec, err := d.newDecoder(d.src)
+		if err != nil {
+			return 0, wrapDecodingError(err)
+		}
+		d.dec = dec
+	}
+	n, err := d.dec.Read(p)
+	if err != nil && err != io.EOF {
+		err = wrapDecodingError(err)
+	}
+	return n, err
+}
+
+// wrapDecodingError marks errors caused by broken encoded data as client errors, while errors of the
+// connection itself or of the body framing are passed through as they are
+func wrapDecodingError(err error) error {
+	var ne net.Error
+	if errors.Is(err, ErrInvalidRequest) || errors.As(err, &ne) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrMalformedContentEncoding, err)
+}
+
+func newGzipDecoder(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// newDeflateDecoder decodes the zlib format mandated by RFC 9110, but falls back to raw deflate streams
+// as quite a few clients send those instead
+func newDeflateDecoder(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil && len(header) < 2 {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+func newBrotliDecoder(r io.Reader) (io.Reader, error) {
+	return brotli.NewReader(r), nil
+}
+
+// maxSizeReader fails with ErrBodyTooLarge once more than n bytes were read from r
+type maxSizeReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	if m.n < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	//read one byte more than allowed to detect bodies that exceed the limit
+	if int64(len(p)) > m.n+1 {
+		p = p[:m.n+1]
+	}
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	if m.n < 0 {
+		return n + int(m.n), ErrBodyTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed compressing test data: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func zlibBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed compressing test data: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func flateBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	_, _ = w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed compressing test data: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func brotliBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	_, _ = w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed compressing test data: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseRequestContentEncoding(t *testing.T) {
+	content := []byte(strings.Repeat(`{"key": "value"}`, 1000))
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     []byte
+		wantErr  error
+	}{
+		{"gzip", "gzip", gzipBytes(t, content), content, nil},
+		{"x-gzip", "x-gzip", gzipBytes(t, content), content, nil},
+		{"deflate (zlib)", "deflate", zlibBytes(t, content), content, nil},
+		{"deflate (raw)", "deflate", flateBytes(t, content), content, nil},
+		{"br", "br", brotliBytes(t, content), content, nil},
+		{"identity", "identity", content, content, nil},
+		{"Stacked encodings", "gzip, br", brotliBytes(t, gzipBytes(t, content)), content, nil},
+		{"Stacked encodings with identity", "GZIP, identity,deflate", zlibBytes(t, gzipBytes(t, content)), content, nil},
+		{"Corrupt gzip", "gzip", []byte("definitely not gzip"), nil, ErrInvalidRequest},
+		{"Truncated gzip", "gzip", gzipBytes(t, content)[:20], nil, ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := fmt.Sprintf("POST /a HTTP/1.1\r\nContent-Encoding: %s\r\nContent-Length: %d\r\n\r\n%s",
+				tt.encoding, len(tt.body), tt.body)
+			req, err := ParseRequest(newTestContext(t), bufio.NewReader(strings.NewReader(raw)))
+			if err != nil {
+				t.Fatalf("ParseRequest() unexpected error: %v", err)
+			}
+			got, err := io.ReadAll(req.Body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("reading body: expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && !bytes.Equal(got, tt.want) {
+				t.Errorf("reading body: got %d bytes, want %d bytes", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseRequestUnsupportedContentEncoding(t *testing.T) {
+	raw := "POST /a HTTP/1.1\r\nContent-Encoding: gzip, compress\r\nContent-Length: 5\r\n\r\nhello"
+	_, err := ParseRequest(newTestContext(t), bufio.NewReader(strings.NewReader(raw)))
+	if !errors.Is(err, ErrUnsupportedContentEncoding) {
+		t.Errorf("expected ErrUnsupportedContentEncoding, got %v", err)
+	}
+}
+
+func TestParseRequestDecompressionBomb(t *testing.T) {
+	oldMax := MaxDecodedBodySize
+	MaxDecodedBodySize = 1 << 20
+	defer func() { MaxDecodedBodySize = oldMax }()
+
+	body := gzipBytes(t, make([]byte, 10<<20))
+	raw := fmt.Sprintf("POST /a HTTP/1.1\r\nContent-Encoding: gzip\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	req, err := ParseRequest(newTestContext(t), bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("ParseRequest() unexpected error: %v", err)
+	}
+	n, err := io.Copy(io.Discard, req.Body)
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("expected ErrBodyTooLarge, got %v", err)
+	}
+	if n > MaxDecodedBodySize {
+		t.Errorf("read %d bytes, more than the limit of %d", n, MaxDecodedBodySize)
+	}
+}
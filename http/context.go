@@ -10,8 +10,23 @@ type Context struct {
 	net.Conn
 	Index          uint64
 	AdditionalData map[string]interface{}
+	Params         map[string]string
+	// Writer streams the response directly to the connection, as an alternative to setting Response.Body
+	Writer *ResponseWriter
 }
 
 func NewContext(conn net.Conn, index uint64) Context {
-	return Context{AdditionalData: make(map[string]interface{}), Conn: conn, Index: index, Response: NewResponse()}
+	response := NewResponse()
+	return Context{
+		AdditionalData: make(map[string]interface{}),
+		Conn:           conn,
+		Index:          index,
+		Response:       response,
+		Writer:         newResponseWriter(conn, response),
+	}
+}
+
+// Param returns the value of the path variable name of the matched route, or an empty string if there is none
+func (c Context) Param(name string) string {
+	return c.Params[name]
 }
@@ -1,7 +1,9 @@
 package http
 
 import (
-	"sort"
+	"net/textproto"
+	"slices"
+	"strings"
 )
 
 type Header struct {
@@ -9,26 +11,87 @@ type Header struct {
 	Value string
 }
 
-type Headers map[string]Header
+// Headers maps canonicalized header names (e.g. Content-Length) to all values of that header in the order they
+// were added. Always use the methods to access it, so lookups are case-insensitive.
+type Headers map[string][]string
 
-func (m Headers) HasHeader(key string) bool {
-	for _, header := range m {
-		if header.Name == key {
-			return true
+// CanonicalHeaderKey returns the canonical format of the header name key, e.g. content-length becomes Content-Length
+func CanonicalHeaderKey(key string) string {
+	return textproto.CanonicalMIMEHeaderKey(key)
+}
+
+// Add appends value to the values of the header name
+func (m Headers) Add(name, value string) {
+	key := CanonicalHeaderKey(name)
+	m[key] = append(m[key], value)
+}
+
+// Set replaces all values of the header name with value
+func (m Headers) Set(name, value string) {
+	m[CanonicalHeaderKey(name)] = []string{value}
+}
+
+// Get returns the first value of the header name, or an empty string if there is none
+func (m Headers) Get(name string) string {
+	if values := m[CanonicalHeaderKey(name)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns all values of the header name in the order they were added
+func (m Headers) Values(name string) []string {
+	return m[CanonicalHeaderKey(name)]
+}
+
+// Combined returns all values of the header name joined by commas, which for list-based headers like Accept is
+// equivalent to receiving them in separate lines (RFC 9110 section 5.3)
+func (m Headers) Combined(name string) string {
+	return strings.Join(m.Values(name), ", ")
+}
+
+// ContainsToken reports whether the list-based header name contains token, ignoring case
+func (m Headers) ContainsToken(name, token string) bool {
+	for _, value := range m.Values(name) {
+		for _, element := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(element), token) {
+				return true
+			}
 		}
 	}
 	return false
 }
 
-// Sorted returns Headers as a slice of Header, where the headers are sorted alphanumerically ascending by their Name property
+// Del removes all values of the header name
+func (m Headers) Del(name string) {
+	delete(m, CanonicalHeaderKey(name))
+}
+
+// Has reports whether there is at least one value for the header name
+func (m Headers) Has(name string) bool {
+	return len(m[CanonicalHeaderKey(name)]) > 0
+}
+
+// HasHeader reports whether there is at least one value for the header key.
+//
+// Deprecated: use Has, HasHeader is kept for callers written before header lookups became case-insensitive.
+func (m Headers) HasHeader(key string) bool {
+	return m.Has(key)
+}
+
+// Sorted returns Headers as a slice of Header, where the headers are sorted alphanumerically ascending by their
+// Name property. Headers with multiple values occur once per value, in the order the values were added.
 func (m Headers) Sorted() []Header {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
 	headers := make([]Header, 0, len(m))
-	for _, header := range m {
-		headers = append(headers, header)
+	for _, name := range names {
+		for _, value := range m[name] {
+			headers = append(headers, Header{name, value})
+		}
 	}
-	// Sort by Name ascending
-	sort.Slice(headers, func(i, j int) bool {
-		return headers[i].Name < headers[j].Name
-	})
 	return headers
 }
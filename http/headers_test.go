@@ -0,0 +1,92 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeadersCaseInsensitive(t *testing.T) {
+	h := make(Headers)
+	h.Set("content-length", "42")
+	if got := h.Get("Content-Length"); got != "42" {
+		t.Errorf("Get(Content-Length) = %q, want %q", got, "42")
+	}
+	if got := h.Get("CONTENT-LENGTH"); got != "42" {
+		t.Errorf("Get(CONTENT-LENGTH) = %q, want %q", got, "42")
+	}
+	if !h.Has("Content-length") || !h.HasHeader("content-length") {
+		t.Errorf("Has(Content-length) = false, want true")
+	}
+	h.Set("Content-Length", "7")
+	if got := h.Values("content-length"); !reflect.DeepEqual(got, []string{"7"}) {
+		t.Errorf("Values(content-length) after Set = %v, want [7]", got)
+	}
+	h.Del("CONTENT-length")
+	if h.Has("Content-Length") || h.Get("Content-Length") != "" {
+		t.Errorf("expected header to be gone after Del")
+	}
+}
+
+func TestHeadersMultipleValues(t *testing.T) {
+	h := make(Headers)
+	h.Add("Accept", "text/html")
+	h.Add("accept", "application/json;q=0.9")
+	h.Add("Connection", "keep-alive, Upgrade")
+	if got := h.Get("Accept"); got != "text/html" {
+		t.Errorf("Get(Accept) = %q, want first value", got)
+	}
+	if got := h.Values("Accept"); !reflect.DeepEqual(got, []string{"text/html", "application/json;q=0.9"}) {
+		t.Errorf("Values(Accept) = %v, want both values in order", got)
+	}
+	if got := h.Combined("Accept"); got != "text/html, application/json;q=0.9" {
+		t.Errorf("Combined(Accept) = %q", got)
+	}
+	if !h.ContainsToken("connection", "upgrade") || h.ContainsToken("Connection", "close") {
+		t.Errorf("ContainsToken reports wrong tokens for %v", h.Values("Connection"))
+	}
+}
+
+func TestResponseWritesRepeatedHeaders(t *testing.T) {
+	r := NewResponse()
+	r.Headers.Add("Set-Cookie", "a=1")
+	r.Headers.Add("set-cookie", "b=2")
+	r.AddHeader(Header{Name: "content-type", Value: "text/plain"})
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := r.writeHeaders(w); err != nil {
+		t.Fatalf("writeHeaders() unexpected error: %v", err)
+	}
+	_ = w.Flush()
+	want := "Content-Type: text/plain\nSet-Cookie: a=1\nSet-Cookie: b=2\n\n"
+	if buf.String() != want {
+		t.Errorf("writeHeaders() wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestParseRequestHeaders(t *testing.T) {
+	raw := "GET / HTTP/1.1\r\nhost: localhost\r\nAccept: text/html\r\nACCEPT: text/plain\r\n\r\n"
+	req, err := ParseRequest(newTestContext(t), bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("ParseRequest() unexpected error: %v", err)
+	}
+	if got := req.Headers.Get("Host"); got != "localhost" {
+		t.Errorf("Get(Host) = %q, want localhost", got)
+	}
+	if got := req.Headers.Values("Accept"); !reflect.DeepEqual(got, []string{"text/html", "text/plain"}) {
+		t.Errorf("Values(Accept) = %v, want both values", got)
+	}
+
+	for _, raw := range []string{
+		"GET / HTTP/1.1\r\nHost : localhost\r\n\r\n",
+		"GET / HTTP/1.1\r\nno colon\r\n\r\n",
+		"POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello",
+	} {
+		if _, err := ParseRequest(newTestContext(t), bufio.NewReader(strings.NewReader(raw))); err == nil {
+			t.Errorf("ParseRequest(%q): expected error", raw)
+		}
+	}
+}
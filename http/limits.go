@@ -0,0 +1,25 @@
+package http
+
+import "fmt"
+
+// RequestLimits bounds how large the request line and the header section of a request may become
+type RequestLimits struct {
+	// MaxRequestLineLength is the maximum length of the request line, longer lines are answered with 414
+	MaxRequestLineLength int
+	// MaxHeaderSize is the maximum length of a single header line, longer lines are answered with 431
+	MaxHeaderSize int
+	// MaxHeaderBytes is the maximum length of all header lines combined, larger sections are answered with 431
+	MaxHeaderBytes int
+	// MaxHeaderCount is the maximum number of header lines, requests with more are answered with 431
+	MaxHeaderCount int
+}
+
+var DefaultRequestLimits = RequestLimits{
+	MaxRequestLineLength: 8 << 10,
+	MaxHeaderSize:        8 << 10,
+	MaxHeaderBytes:       64 << 10,
+	MaxHeaderCount:       100,
+}
+
+var ErrURITooLong = fmt.Errorf("request line too long")
+var ErrRequestHeaderFieldsTooLarge = fmt.Errorf("request header fields too large")
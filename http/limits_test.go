@@ -0,0 +1,44 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseRequestWithLimits(t *testing.T) {
+	limits := RequestLimits{
+		MaxRequestLineLength: 64,
+		MaxHeaderSize:        32,
+		MaxHeaderBytes:       64,
+		MaxHeaderCount:       3,
+	}
+	header := func(n int) string {
+		return fmt.Sprintf("X-H%d: v\r\n", n)
+	}
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr error
+	}{
+		{"Within limits", "GET /short HTTP/1.1\r\n" + header(1) + header(2) + header(3) + "\r\n", nil},
+		{"Request line at limit", "GET /" + strings.Repeat("a", 50) + " HTTP/1.1\r\n\r\n", nil},
+		{"Request line too long", "GET /" + strings.Repeat("a", 51) + " HTTP/1.1\r\n\r\n", ErrURITooLong},
+		{"Very long request line", "GET /" + strings.Repeat("a", 100000) + " HTTP/1.1\r\n\r\n", ErrURITooLong},
+		{"Header too long", "GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", 30) + "\r\n\r\n", ErrRequestHeaderFieldsTooLarge},
+		{"Too many headers", "GET / HTTP/1.1\r\n" + header(1) + header(2) + header(3) + header(4) + "\r\n", ErrRequestHeaderFieldsTooLarge},
+		{"Header section too large", "GET / HTTP/1.1\r\n" + strings.Repeat("X-Header-Name: value-value\r\n", 3) + "\r\n", ErrRequestHeaderFieldsTooLarge},
+		{"Bare CR in request line", "GET /a\rb HTTP/1.1\r\n\r\n", ErrInvalidRequest},
+		{"Incomplete headers", "GET / HTTP/1.1\r\nHost: a", ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRequestWithLimits(newTestContext(t), bufio.NewReader(strings.NewReader(tt.raw)), limits)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("ParseRequestWithLimits() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var errLineTooLong = fmt.Errorf("line too long")
+var errBareCR = fmt.Errorf("bare CR in line")
+
+// readLine reads a line of at most maxLen bytes and returns it without the line terminator. A bare LF is
+// accepted as line terminator, but a CR anywhere else in the line is not. If r ends before the line does,
+// io.EOF is returned.
+func readLine(r *bufio.Reader, maxLen int) ([]byte, error) {
+	var line []byte
+	for {
+		part, err := r.ReadSlice('\n')
+		line = append(line, part...)
+		//+2 for the CRLF, so we never buffer much more than maxLen before giving up
+		if len(line) > maxLen+2 {
+			return nil, errLineTooLong
+		}
+		if err == nil {
+			break
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		return nil, err
+	}
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'})
+	if len(line) > maxLen {
+		return nil, errLineTooLong
+	}
+	if bytes.IndexByte(line, '\r') != -1 {
+		return nil, errBareCR
+	}
+	return line, nil
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxRanges is the amount of ranges a single Range header may request, more are rejected to keep multipart responses small
+const maxRanges = 64
+
+var ErrMalformedRange = fmt.Errorf("malformed range")
+var ErrRangeNotSatisfiable = fmt.Errorf("range not satisfiable")
+
+// ByteRange is a range of Length bytes beginning at Start in a representation
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange returns the value of the Content-Range header for the range in a representation of size bytes
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// UnsatisfiedContentRange returns the value of the Content-Range header of a 416 response for a representation of size bytes
+func UnsatisfiedContentRange(size int64) string {
+	return fmt.Sprintf("bytes */%d", size)
+}
+
+// ParseRange parses the value of a Range header (RFC 9110 section 14.2) for a representation of size bytes. Ranges
+// that begin after the end of the representation are dropped, if none remain ErrRangeNotSatisfiable is returned.
+// Overlapping and adjacent ranges are coalesced, so no byte of the representation is sent more than once.
+// A header in another unit than bytes yields no ranges and no error, as it must be ignored.
+func ParseRange(header string, size int64) ([]ByteRange, error) {
+	unit, set, found := strings.Cut(strings.TrimSpace(header), "=")
+	if !found {
+		return nil, fmt.Errorf("%w: missing range unit", ErrMalformedRange)
+	}
+	if !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, nil
+	}
+
+	var ranges []ByteRange
+	specs := 0
+	for _, spec := range strings.Split(set, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		specs++
+		if specs > maxRanges {
+			return nil, fmt.Errorf("%w: more than %d ranges", ErrMalformedRange, maxRanges)
+		}
+		r, ok, err := parseRangeSpec(spec, size)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ranges = append(ranges, r)
+		}
+	}
+	if specs == 0 {
+		return nil, fmt.Errorf("%w: empty range set", ErrMalformedRange)
+	}
+	if len(ranges) == 0 {
+		return nil, ErrRangeNotSatisfiable
+	}
+	return coalesceRanges(ranges), nil
+}
+
+// coalesceRanges sorts ranges by their start and merges the ones that overlap or are adjacent
+func coalesceRanges(ranges []ByteRange) []ByteRange {
+	slices.SortFunc(ranges, func(a, b ByteRange) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.Start+last.Length {
+			last.Length = max(last.Length, r.Start+r.Length-last.Start)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// parseRangeSpec parses a single int-range or suffix-range, reporting whether it is satisfiable for size bytes
+func parseRangeSpec(spec string, size int64) (ByteRange, bool, error) {
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return ByteRange{}, false, fmt.Errorf("%w: %q", ErrMalformedRange, spec)
+	}
+	if first == "" {
+		//suffix range: the last n bytes
+		n, err := parseRangeInt(last)
+		if err != nil {
+			return ByteRange{}, false, err
+		}
+		if n == 0 || size == 0 {
+			return ByteRange{}, false, nil
+		}
+		n = min(n, size)
+		return ByteRange{Start: size - n, Length: n}, true, nil
+	}
+	start, err := parseRangeInt(first)
+	if err != nil {
+		return ByteRange{}, false, err
+	}
+	end := size - 1
+	if last != "" {
+		end, err = parseRangeInt(last)
+		if err != nil {
+			return ByteRange{}, false, err
+		}
+		if end < start {
+			return ByteRange{}, false, fmt.Errorf("%w: %q ends before it starts", ErrMalformedRange, spec)
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return ByteRange{}, false, nil
+	}
+	return ByteRange{Start: start, Length: end - start + 1}, true, nil
+}
+
+func parseRangeInt(s string) (int64, error) {
+	//only digits are allowed, ParseInt would also accept a sign
+	for _, c := range []byte(s) {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%w: invalid position %q", ErrMalformedRange, s)
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid position %q", ErrMalformedRange, s)
+	}
+	return n, nil
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		size    int64
+		want    []ByteRange
+		wantErr error
+	}{
+		{"Single range", "bytes=0-99", 1000, []ByteRange{{0, 100}}, nil},
+		{"Open ended", "bytes=900-", 1000, []ByteRange{{900, 100}}, nil},
+		{"Suffix", "bytes=-100", 1000, []ByteRange{{900, 100}}, nil},
+		{"Suffix longer than file", "bytes=-5000", 1000, []ByteRange{{0, 1000}}, nil},
+		{"End clamped to size", "bytes=500-5000", 1000, []ByteRange{{500, 500}}, nil},
+		{"Multiple ranges", "bytes=0-0, -1", 1000, []ByteRange{{0, 1}, {999, 1}}, nil},
+		{"Unit is case-insensitive", "Bytes=1-1", 10, []ByteRange{{1, 1}}, nil},
+		{"Empty elements are skipped", "bytes=, 1-2,", 10, []ByteRange{{1, 2}}, nil},
+		{"Unsatisfiable ranges are dropped", "bytes=2000-3000, 1-2", 10, []ByteRange{{1, 2}}, nil},
+		{"Duplicate ranges are merged", "bytes=0-,0-,0-", 1000, []ByteRange{{0, 1000}}, nil},
+		{"Overlapping ranges are merged", "bytes=500-599, 0-99, 50-149, -450", 1000, []ByteRange{{0, 150}, {500, 500}}, nil},
+		{"Adjacent ranges are merged", "bytes=0-9, 10-19", 1000, []ByteRange{{0, 20}}, nil},
+		{"Unknown unit is ignored", "items=0-5", 10, nil, nil},
+		{"Start after end", "bytes=1000-", 1000, nil, ErrRangeNotSatisfiable},
+		{"Zero suffix", "bytes=-0", 1000, nil, ErrRangeNotSatisfiable},
+		{"Empty file", "bytes=0-", 0, nil, ErrRangeNotSatisfiable},
+		{"Missing unit", "0-99", 1000, nil, ErrMalformedRange},
+		{"Missing dash", "bytes=5", 1000, nil, ErrMalformedRange},
+		{"Last before first", "bytes=10-5", 1000, nil, ErrMalformedRange},
+		{"Signed position", "bytes=+1-5", 1000, nil, ErrMalformedRange},
+		{"Empty range set", "bytes=", 1000, nil, ErrMalformedRange},
+		{"Overflowing position", "bytes=99999999999999999999-", 1000, nil, ErrMalformedRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRange(tt.header, tt.size)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("ParseRange() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	etag := `"abc"`
+	lastModified := time.Date(2024, time.March, 10, 12, 0, 0, 500, time.UTC)
+	tests := []struct {
+		name    string
+		ifRange string
+		want    bool
+	}{
+		{"Missing", "", true},
+		{"Matching ETag", `"abc"`, true},
+		{"Other ETag", `"other"`, false},
+		{"Weak ETag", `W/"abc"`, false},
+		{"Matching date", "Sun, 10 Mar 2024 12:00:00 GMT", true},
+		{"Earlier date", "Sun, 10 Mar 2024 11:00:00 GMT", false},
+		{"Invalid date", "soon", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Request{Method: GET, Headers: make(Headers)}
+			if tt.ifRange != "" {
+				r.Headers.Set("If-Range", tt.ifRange)
+			}
+			if got := IfRangeMatches(r, etag, lastModified); got != tt.want {
+				t.Errorf("IfRangeMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
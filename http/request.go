@@ -2,8 +2,9 @@ package http
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"slices"
+	"io"
 	"strconv"
 	"strings"
 	"time"
@@ -12,14 +13,23 @@ import (
 type Request struct {
 	Method
 	Version
+	// Path is the decoded and normalized path of the request target, see URL for the raw path and query
 	Path    string
+	URL     *URL
 	Headers Headers
-	Body    []byte
+	Body    io.ReadCloser
+	// Trailers holds the trailer fields of a chunked body, it is only filled once the body was read completely
+	Trailers Headers
+	// Close is set if the connection has to be closed after answering the request, because its framing is ambiguous
+	Close bool
 }
 
+const readTimeout = 5 * time.Second
+
 var ErrInvalidRequest = fmt.Errorf("invalid HTTP request format")
 var ErrInvalidHttpMethod = fmt.Errorf("invalid HTTP method")
 var ErrInvalidHttpVersion = fmt.Errorf("invalid HTTP version")
+var ErrUnsupportedTransferEncoding = fmt.Errorf("unsupported transfer encoding")
 
 type errInvalidHttpMethod struct {
 	Method string
@@ -45,15 +55,23 @@ func (e errInvalidHttpVersion) Error() string {
 	return fmt.Sprintf("invalid HTTP version: %s", e.Version)
 }
 
-func ParseRequest(ctx Context, r *bufio.Reader, s *bufio.Scanner) (*Request, error) {
+// ParseRequest reads the next request from r using DefaultRequestLimits, see ParseRequestWithLimits
+func ParseRequest(ctx Context, r *bufio.Reader) (*Request, error) {
+	return ParseRequestWithLimits(ctx, r, DefaultRequestLimits)
+}
+
+// ParseRequestWithLimits reads the request line and headers of the next request from r. The body is not read, instead
+// Request.Body streams it from r on demand and must be closed before the next request can be parsed from r.
+// If the request line or headers exceed limits, ErrURITooLong or ErrRequestHeaderFieldsTooLarge is returned.
+func ParseRequestWithLimits(ctx Context, r *bufio.Reader, limits RequestLimits) (*Request, error) {
 	//set a 5s read timeout on the underlying connection
-	err := ctx.Conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	err := ctx.Conn.SetReadDeadline(time.Now().Add(readTimeout))
 	if err != nil {
 		return nil, fmt.Errorf("couldn't set read deadline on conn when parsing request")
 	}
 
-	request := &Request{}
-	buf, err := readRequestLineAndHeaders(ctx, s)
+	request := &Request{Body: NoBody}
+	buf, err := readRequestLineAndHeaders(ctx, r, limits)
 	if err != nil {
 		return nil, err
 	}
@@ -64,57 +82,81 @@ func ParseRequest(ctx Context, r *bufio.Reader, s *bufio.Scanner) (*Request, err
 		return nil, err
 	}
 
-	//determine if we need to look for a body too
-	//refuse reading body on GET, HEAD, OPTIONS, CONNECT and TRACE
-	if request.Method == GET ||
-		request.Method == HEAD ||
-		request.Method == OPTIONS ||
-		request.Method == CONNECT ||
-		request.Method == TRACE {
-		return request, nil
-	}
-
-	for _, header := range request.Headers {
-		//if we have a Content-Length header, we read the expected length of bytes as the body
-		if header.Name == "Content-Length" {
-			err = handleContentLength(request, r)
-			break
-		} else if header.Name == "Transfer-Encoding" {
-			err = handleTransferEncoding(request, s)
-			break
+	//bodies are framed for every method (even if e.g. a body on GET has no meaning), otherwise the body
+	//would be mistaken for the next request on the connection
+	//Transfer-Encoding takes precedence over Content-Length
+	if request.Headers.Has("Transfer-Encoding") {
+		//HTTP/1.0 has no Transfer-Encoding, so we can't tell where the body ends (RFC 9112 section 6.1)
+		if request.Version == HTTP1_0 {
+			ctx.AdditionalData["BadRequestReason"] = "Transfer-Encoding in HTTP/1.0 request"
+			return nil, fmt.Errorf("%w: Transfer-Encoding in HTTP/1.0 request", ErrInvalidRequest)
 		}
+		//an intermediary may have framed the body by its Content-Length instead, so whatever follows on the
+		//connection can't be trusted to be the next request (request smuggling, RFC 9112 section 6.1)
+		request.Close = request.Headers.Has("Content-Length")
+		err = handleTransferEncoding(ctx, request, r)
+	} else if request.Headers.Has("Content-Length") {
+		err = handleContentLength(ctx, request, r)
+	}
+	if errors.Is(err, ErrUnsupportedContentEncoding) || errors.Is(err, ErrUnsupportedTransferEncoding) {
+		return nil, err
 	}
 	if err != nil {
 		ctx.AdditionalData["BadRequestReason"] = "Failed parsing request body"
-		return nil, fmt.Errorf("failed parsing request body: %w", err)
+		return nil, fmt.Errorf("%w: failed parsing request body: %w", ErrInvalidRequest, err)
 	}
 
 	return request, nil
-
 }
 
-func readRequestLineAndHeaders(ctx Context, s *bufio.Scanner) ([]string, error) {
-	buf := []string{}
-	//we already advanced the scanner by one token when checking if there was another request in the conn
-	//so we must read the first token right away before calling s.Scan again
-	for {
-		line := s.Text()
-		if line == "" {
-			break
-		}
-		buf = append(buf, line+"\n")
-		if !s.Scan() {
-			break
-		}
+func readRequestLineAndHeaders(ctx Context, r *bufio.Reader, limits RequestLimits) ([]string, error) {
+	line, err := readLine(r, limits.MaxRequestLineLength)
+	if err != nil {
+		return nil, requestLineError(ctx, err)
 	}
-	if len(buf) == 0 {
+	if len(line) == 0 {
 		//invalid request
 		ctx.AdditionalData["BadRequestReason"] = "Empty request"
 		return nil, fmt.Errorf("%w: empty buffer", ErrInvalidRequest)
 	}
+	buf := []string{string(line)}
+
+	headerBytes := 0
+	for {
+		line, err := readLine(r, min(limits.MaxHeaderSize, limits.MaxHeaderBytes-headerBytes))
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				return nil, fmt.Errorf("%w: header line too long or header section exceeds %d bytes",
+					ErrRequestHeaderFieldsTooLarge, limits.MaxHeaderBytes)
+			}
+			return nil, requestLineError(ctx, err)
+		}
+		if len(line) == 0 {
+			break
+		}
+		if len(buf)-1 >= limits.MaxHeaderCount {
+			return nil, fmt.Errorf("%w: more than %d headers", ErrRequestHeaderFieldsTooLarge, limits.MaxHeaderCount)
+		}
+		headerBytes += len(line)
+		buf = append(buf, string(line))
+	}
 	return buf, nil
 }
 
+// requestLineError converts an error from reading a line of the request line or headers into the error we report
+func requestLineError(ctx Context, err error) error {
+	switch {
+	case errors.Is(err, errLineTooLong):
+		return fmt.Errorf("%w: request line is longer than the limit", ErrURITooLong)
+	case errors.Is(err, errBareCR):
+		ctx.AdditionalData["BadRequestReason"] = "Invalid line ending"
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	default:
+		ctx.AdditionalData["BadRequestReason"] = "Incomplete request"
+		return fmt.Errorf("%w: failed reading request line and headers: %w", ErrInvalidRequest, err)
+	}
+}
+
 func parseRequestLineAndHeaders(buf []string, request *Request, ctx Context) error {
 	//parse method, path, version and headers
 	firstLineParts := strings.Split(buf[0], " ")
@@ -128,7 +170,12 @@ func parseRequestLineAndHeaders(buf []string, request *Request, ctx Context) err
 		ctx.AdditionalData["BadRequestReason"] = "Invalid HTTP method"
 		return fmt.Errorf("unable to parse request: %w", err)
 	}
-	request.Path = firstLineParts[1]
+	request.URL, err = ParseRequestTarget(firstLineParts[1])
+	if err != nil {
+		ctx.AdditionalData["BadRequestReason"] = "Invalid request target"
+		return fmt.Errorf("unable to parse request: %w", err)
+	}
+	request.Path = request.URL.Path
 	request.Version, err = parseVersion(firstLineParts[2])
 	if err != nil {
 		ctx.AdditionalData["BadRequestReason"] = "Invalid HTTP version"
@@ -136,114 +183,82 @@ func parseRequestLineAndHeaders(buf []string, request *Request, ctx Context) err
 	}
 
 	//parse headers
-	request.Headers = make(map[string]Header)
-	//we assume every line after the first line is a header
-	//until we find an empty line
+	request.Headers = make(Headers)
+	//every line after the first line is a header, the empty line terminating them was already consumed
 	for _, line := range buf[1:] {
-		if line == "\n" {
-			break
-		}
 		s := strings.SplitN(line, ":", 2)
-		name := strings.TrimSpace(s[0])
-		value := strings.TrimSpace(s[1])
-		request.Headers[name] = Header{
-			name, value,
+		if len(s) != 2 {
+			ctx.AdditionalData["BadRequestReason"] = "Invalid header"
+			return fmt.Errorf("%w: header line without colon", ErrInvalidRequest)
+		}
+		//no whitespace is allowed between the field name and the colon (RFC 9112 section 5.1)
+		name := s[0]
+		if !isToken(name) {
+			ctx.AdditionalData["BadRequestReason"] = "Invalid header"
+			return fmt.Errorf("%w: invalid header name %q", ErrInvalidRequest, name)
 		}
+		value := strings.TrimSpace(s[1])
+		request.Headers.Add(name, value)
 	}
 	return nil
 }
 
-func handleContentLength(request *Request, r *bufio.Reader) error {
-	bodyLen, err := strconv.Atoi(request.Headers["Content-Length"].Value)
-	if err != nil {
-		return fmt.Errorf("could not parse Content-Length: %v", err)
+func handleContentLength(ctx Context, request *Request, r *bufio.Reader) error {
+	lengths := request.Headers.Values("Content-Length")
+	//repeated Content-Length headers are only acceptable if they all agree
+	for _, length := range lengths[1:] {
+		if length != lengths[0] {
+			return fmt.Errorf("conflicting Content-Length headers")
+		}
 	}
-
-	//force read bodyLen bytes from the connection
-	buffer := make([]byte, bodyLen)
-	n, err := r.Read(buffer)
+	//the grammar is 1*DIGIT, ParseInt would also accept a sign, which other servers may frame differently
+	for _, c := range []byte(lengths[0]) {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("invalid Content-Length %q", lengths[0])
+		}
+	}
+	bodyLen, err := strconv.ParseInt(lengths[0], 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to read body: %v", err)
+		return fmt.Errorf("could not parse Content-Length: %v", err)
 	}
-	if n != bodyLen {
-		return fmt.Errorf("unexpected body length %d instead of %d", n, bodyLen)
+	if bodyLen == 0 {
+		return nil
 	}
-
-	decoded, err := handleContentEncoding(buffer, request)
+	framed := &lengthReader{r, bodyLen}
+	decoded, err := handleContentEncoding(framed, request)
 	if err != nil {
-		return fmt.Errorf("failed to decode body: %v", err)
+		return fmt.Errorf("failed to decode body: %w", err)
 	}
-
-	request.Body = decoded
+	request.Body = newBody(ctx.Conn, decoded, framed)
 	return nil
 }
 
-func handleTransferEncoding(request *Request, s *bufio.Scanner) error {
-	buffer := make([]byte, 0)
-	//loop until we read a zero and an empty line (end of body)
-	for s.Scan() {
-		//read length of next block
-		blockLen := s.Text()
-
-		bodyLen, err := strconv.ParseInt(blockLen, 16, 64)
-		if err != nil {
-			return fmt.Errorf("failed to read transfer encoding block length: %v", err)
-		}
-
-		if bodyLen == 0 {
-			b, err := readChunk(s, bodyLen)
-			if err != nil {
-				return err
-			}
-			if len(b) == 0 {
-				//done reading
-				break
-			} else {
-				return fmt.Errorf("received 0 block length but following line was not empty")
-			}
-		}
-
-		b, err := readChunk(s, bodyLen)
-		if err != nil {
-			return err
+func handleTransferEncoding(ctx Context, request *Request, r *bufio.Reader) error {
+	te := request.Headers.Combined("Transfer-Encoding")
+	codings := strings.Split(te, ",")
+	//without chunked as the last coding, the body can only end when the connection is closed, which a request can't do
+	if !strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+		return fmt.Errorf("transfer encoding %s doesn't end with chunked", te)
+	}
+	for _, coding := range codings[:len(codings)-1] {
+		if strings.EqualFold(strings.TrimSpace(coding), "chunked") {
+			return fmt.Errorf("transfer encoding %s applies chunked more than once", te)
 		}
-
-		//append b to buffer
-		buffer = slices.Concat(buffer, b)
 	}
-
-	//decode
-	buffer, err := handleContentEncoding(buffer, request)
+	//we only implement chunked, any other coding has to be answered with 501 (RFC 9112 section 6.1)
+	if len(codings) > 1 {
+		return fmt.Errorf("%w: %s", ErrUnsupportedTransferEncoding, te)
+	}
+	request.Trailers = make(Headers)
+	framed := newChunkedReader(r, request.Trailers)
+	decoded, err := handleContentEncoding(framed, request)
 	if err != nil {
 		return err
 	}
-
-	request.Body = buffer
-
+	request.Body = newBody(ctx.Conn, decoded, framed)
 	return nil
 }
 
-func readChunk(s *bufio.Scanner, bodyLen int64) ([]byte, error) {
-	if !s.Scan() {
-		return nil, fmt.Errorf("unexpected end of body")
-	}
-	err := s.Err()
-	if err != nil {
-		return nil, err
-	}
-	retval := s.Bytes()
-	if int64(len(retval)) != bodyLen {
-		return nil, fmt.Errorf("unexpected body length %d instead of %d", len(retval), bodyLen)
-	}
-
-	return retval, nil
-}
-
-func handleContentEncoding(data []byte, request *Request) ([]byte, error) {
-	//TODO: support content encoding in requests?
-	return data, nil
-}
-
 func parseMethod(method string) (Method, error) {
 	switch method {
 	case "GET":
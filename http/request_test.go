@@ -0,0 +1,153 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// newTestContext returns a context whose connection only serves for setting deadlines, the request itself is read
+// from the reader passed to ParseRequest
+func newTestContext(t *testing.T) Context {
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() {
+		_ = c1.Close()
+		_ = c2.Close()
+	})
+	return NewContext(c1, 0)
+}
+
+func TestParseRequestStreamsBody(t *testing.T) {
+	bodyContent := strings.Repeat("0123456789", 10000)
+	raw := "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100000\r\n\r\n" + bodyContent +
+		"GET /next HTTP/1.1\r\nHost: localhost\r\n\r\n"
+	//a tiny buffer forces the body to be read in many short reads
+	r := bufio.NewReaderSize(strings.NewReader(raw), 16)
+
+	req, err := ParseRequest(newTestContext(t), r)
+	if err != nil {
+		t.Fatalf("ParseRequest() unexpected error: %v", err)
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("reading body: unexpected error: %v", err)
+	}
+	if string(b) != bodyContent {
+		t.Errorf("expected body of length %d, got %d bytes", len(bodyContent), len(b))
+	}
+	if err := req.Body.Close(); err != nil {
+		t.Fatalf("closing body: unexpected error: %v", err)
+	}
+
+	next, err := ParseRequest(newTestContext(t), r)
+	if err != nil {
+		t.Fatalf("ParseRequest() for second request unexpected error: %v", err)
+	}
+	if next.Path != "/next" {
+		t.Errorf("expected second request for /next, got %s", next.Path)
+	}
+}
+
+func TestParseRequestDrainsUnreadBody(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"Content-Length", "POST /a HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world"},
+		{"Chunked", "POST /a HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"},
+		{"Body on GET", "GET /a HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.raw + "GET /next HTTP/1.1\r\n\r\n"))
+			req, err := ParseRequest(newTestContext(t), r)
+			if err != nil {
+				t.Fatalf("ParseRequest() unexpected error: %v", err)
+			}
+			//read only a part of the body
+			_, _ = req.Body.Read(make([]byte, 2))
+			if err := req.Body.Close(); err != nil {
+				t.Fatalf("closing body: unexpected error: %v", err)
+			}
+			if _, err := req.Body.Read(make([]byte, 2)); err != ErrBodyReadAfterClose {
+				t.Errorf("expected ErrBodyReadAfterClose when reading closed body, got %v", err)
+			}
+			next, err := ParseRequest(newTestContext(t), r)
+			if err != nil {
+				t.Fatalf("ParseRequest() for second request unexpected error: %v", err)
+			}
+			if next.Path != "/next" {
+				t.Errorf("expected second request for /next, got %s", next.Path)
+			}
+		})
+	}
+}
+
+func TestParseRequestTruncatedBody(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("POST /a HTTP/1.1\r\nContent-Length: 20\r\n\r\nshort"))
+	req, err := ParseRequest(newTestContext(t), r)
+	if err != nil {
+		t.Fatalf("ParseRequest() unexpected error: %v", err)
+	}
+	if _, err := io.ReadAll(req.Body); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF for truncated body, got %v", err)
+	}
+}
+
+func TestParseRequestAmbiguousFraming(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("POST /a HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\n" +
+		"5\r\nhello\r\n0\r\n\r\n"))
+	req, err := ParseRequest(newTestContext(t), r)
+	if err != nil {
+		t.Fatalf("ParseRequest() unexpected error: %v", err)
+	}
+	if b, err := io.ReadAll(req.Body); err != nil || string(b) != "hello" {
+		t.Errorf("expected chunked body to take precedence, got %q, %v", b, err)
+	}
+	if !req.Close {
+		t.Errorf("expected connection to be closed after a request with Transfer-Encoding and Content-Length")
+	}
+
+	r = bufio.NewReader(strings.NewReader("POST /a HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"))
+	if _, err := ParseRequest(newTestContext(t), r); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected ErrInvalidRequest for Transfer-Encoding in HTTP/1.0 request, got %v", err)
+	}
+}
+
+func TestParseRequestTransferCodings(t *testing.T) {
+	tests := []struct {
+		name    string
+		te      string
+		wantErr error
+	}{
+		{"Chunked", "chunked", nil},
+		{"Chunked is case-insensitive", " Chunked ", nil},
+		{"Unsupported coding before chunked", "gzip, chunked", ErrUnsupportedTransferEncoding},
+		{"Last coding isn't chunked", "chunked, gzip", ErrInvalidRequest},
+		{"Only unknown coding", "gzip", ErrInvalidRequest},
+		{"Chunked twice", "chunked, chunked", ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader("POST /a HTTP/1.1\r\nTransfer-Encoding: " + tt.te + "\r\n\r\n0\r\n\r\n"))
+			_, err := ParseRequest(newTestContext(t), r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseRequest() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRequestInvalidContentLength(t *testing.T) {
+	for _, length := range []string{"+5", "-0", "-5", "5 5", "0x5", "", "99999999999999999999"} {
+		t.Run(length, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader("POST /a HTTP/1.1\r\nContent-Length: " + length + "\r\n\r\nhello"))
+			if _, err := ParseRequest(newTestContext(t), r); !errors.Is(err, ErrInvalidRequest) {
+				t.Errorf("ParseRequest() error = %v, want ErrInvalidRequest", err)
+			}
+		})
+	}
+}
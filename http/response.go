@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"gophttp/common/ascii"
+	"io"
 	"net"
 	"strconv"
 	"strings"
@@ -14,21 +15,32 @@ import (
 type Response struct {
 	Status
 	Headers Headers
-	Body    interface{}
+	// Body may be nil, a string, []byte, bytes.Buffer, chan StreamedResponseChunk, any io.Reader or any io.WriterTo.
+	// Bodies whose length is known up front (see BodyLength) are sent with a Content-Length, all others chunked.
+	Body interface{}
+	// OmitBody makes WriteToConn send only the status line and headers, as required for responses to HEAD requests.
+	// The headers are still computed from the body, so they are the same as without OmitBody.
+	OmitBody bool
 }
 
 func NewResponse() *Response {
-	return &Response{Headers: make(map[string]Header)}
+	return &Response{Headers: make(Headers)}
 }
 
-// AddHeader adds the given header to the response, overwriting any header that might be present already for the given key
+// AddHeader adds the given header to the response, overwriting any header that might be present already for the given key.
+// Use Headers.Add for headers that may occur multiple times, like Set-Cookie.
 func (r Response) AddHeader(header Header) {
-	r.Headers[header.Name] = header
+	r.Headers.Set(header.Name, header.Value)
 }
 
 var ErrUnknownBodyType = fmt.Errorf("unknown body type")
 
+// WriteToConn writes the status line, headers and body to conn, using chunked encoding if the Transfer-Encoding header
+// says so. Bodies implementing io.Closer (e.g. *os.File) are closed afterwards, no matter whether writing them succeeded.
 func (r Response) WriteToConn(conn net.Conn) error {
+	if c, ok := r.Body.(io.Closer); ok {
+		defer c.Close()
+	}
 	w := bufio.NewWriter(conn)
 	_, err := w.WriteString(fmt.Sprintf("HTTP/1.1 %s\n", r.Status))
 	if err != nil {
@@ -44,24 +56,15 @@ func (r Response) WriteToConn(conn net.Conn) error {
 	if r.Body == nil {
 		return w.Flush()
 	}
-
-	//write body depending on the type of data
-	if s, ok := r.Body.(string); ok {
-		_, err = w.WriteString(s)
-		if err != nil {
-			return err
-		}
-	} else if b, ok := r.Body.([]byte); ok {
-		_, err = w.Write(b)
-		if err != nil {
-			return err
-		}
-	} else if b, ok := r.Body.(bytes.Buffer); ok {
-		_, err := w.Write(b.Bytes())
-		if err != nil {
-			return err
+	if r.OmitBody {
+		//the producer of a channel body would block forever if nobody received its chunks
+		if c, ok := r.Body.(chan StreamedResponseChunk); ok {
+			DiscardChannel(c)
 		}
-	} else if c, ok := r.Body.(chan StreamedResponseChunk); ok {
+		return w.Flush()
+	}
+
+	if c, ok := r.Body.(chan StreamedResponseChunk); ok {
 		//if we get a byte slice channel, start a loop where we read from said channel until it closes
 		//we block here and do not create another goroutine because we need to wait until we fully wrote our response
 		//before moving on to the next request in the TCP connection
@@ -79,16 +82,65 @@ func (r Response) WriteToConn(conn net.Conn) error {
 				if err != nil {
 					return err
 				}
-			case <-time.After(15 * time.Second): //TODO: make configurable
+			case <-time.After(bodyChannelTimeout):
 				return fmt.Errorf("read timeout on body channel")
 			}
 		}
-	} else {
-		//log and return err (500)
-		return fmt.Errorf("%v: %T", ErrUnknownBodyType, r.Body)
 	}
 
-	return w.Flush()
+	if r.Headers.ContainsToken("Transfer-Encoding", "chunked") {
+		cw := &chunkedWriter{w}
+		err = writeBody(cw, r.Body)
+		if err != nil {
+			return err
+		}
+		err = cw.Close()
+		if err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	switch r.Body.(type) {
+	case string, []byte, bytes.Buffer:
+		err = writeBody(w, r.Body)
+		if err != nil {
+			return err
+		}
+		return w.Flush()
+	case io.Reader, io.WriterTo:
+		//write the headers first, then copy the body to the connection itself instead of through the buffered writer,
+		//so the kernel can send files directly to a *net.TCPConn with sendfile
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+		return writeBody(conn, r.Body)
+	default:
+		//nothing was sent yet, so the caller can still answer with an error instead
+		return fmt.Errorf("%w: %T", ErrUnknownBodyType, r.Body)
+	}
+}
+
+// writeBody writes every body type except channels to w
+func writeBody(w io.Writer, body interface{}) error {
+	var err error
+	switch v := body.(type) {
+	case string:
+		_, err = io.WriteString(w, v)
+	case []byte:
+		_, err = w.Write(v)
+	case bytes.Buffer:
+		_, err = w.Write(v.Bytes())
+	case io.Reader:
+		_, err = io.Copy(w, v)
+	case io.WriterTo:
+		_, err = v.WriteTo(w)
+	default:
+		//log and return err (500)
+		err = fmt.Errorf("%w: %T", ErrUnknownBodyType, body)
+	}
+	return err
 }
 
 func (r Response) writeHeaders(w *bufio.Writer) error {
@@ -133,3 +185,24 @@ func writeCRLF(w *bufio.Writer) error {
 	_, err := w.Write([]byte{ascii.CR, ascii.LF})
 	return err
 }
+
+// chunkedWriter writes everything written to it as chunks, Close writes the terminating last-chunk
+type chunkedWriter struct {
+	w *bufio.Writer
+}
+
+func (c *chunkedWriter) Write(p []byte) (int, error) {
+	//an empty chunk would terminate the body
+	if len(p) == 0 {
+		return 0, nil
+	}
+	err := handleChunk(StreamedResponseChunk{Data: p}, c.w)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *chunkedWriter) Close() error {
+	return handleChunk(StreamedResponseChunk{Data: make([]byte, 0)}, c.w)
+}
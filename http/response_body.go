@@ -0,0 +1,127 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrBodyLengthMismatch = fmt.Errorf("response body shorter than its announced length")
+
+// SizedReader is a response body of a known length, so it is sent with a Content-Length header instead of chunked.
+// It never reads more than the given size from the wrapped reader.
+type SizedReader struct {
+	r io.Reader
+	n int64
+}
+
+// NewSizedReader wraps r, which yields size bytes, into a body of known length. If r is an io.Closer, closing the
+// SizedReader closes r.
+func NewSizedReader(r io.Reader, size int64) *SizedReader {
+	return &SizedReader{r: r, n: size}
+}
+
+// NewFileSection returns a response body streaming length bytes of file starting at offset. The body takes ownership
+// of file and closes it when it is closed. Like a plain *os.File body, it is copied to the connection with sendfile.
+func NewFileSection(file *os.File, offset, length int64) (*SizedReader, error) {
+	_, err := file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return NewSizedReader(file, length), nil
+}
+
+// Size returns the amount of bytes that are left to read
+func (s *SizedReader) Size() int64 {
+	return s.n
+}
+
+func (s *SizedReader) Read(p []byte) (int, error) {
+	if s.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > s.n {
+		p = p[:s.n]
+	}
+	n, err := s.r.Read(p)
+	s.n -= int64(n)
+	return n, err
+}
+
+// WriteTo copies the remaining bytes to w. The wrapped reader is handed to w as an *io.LimitedReader, which a
+// *net.TCPConn sends with sendfile if it wraps an *os.File.
+func (s *SizedReader) WriteTo(w io.Writer) (int64, error) {
+	lr := &io.LimitedReader{R: s.r, N: s.n}
+	n, err := io.Copy(w, lr)
+	s.n = lr.N
+	if err == nil && s.n > 0 {
+		//the Content-Length was already sent, the client would wait for the missing bytes forever
+		return n, fmt.Errorf("%w: %d bytes missing", ErrBodyLengthMismatch, s.n)
+	}
+	return n, err
+}
+
+func (s *SizedReader) Close() error {
+	if c, ok := s.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// BodyLength returns the length of a response body, if it can be known without consuming it
+func BodyLength(body interface{}) (int64, bool) {
+	switch v := body.(type) {
+	case nil:
+		return 0, true
+	case string:
+		return int64(len(v)), true
+	case []byte:
+		return int64(len(v)), true
+	case bytes.Buffer:
+		return int64(v.Len()), true
+	case *SizedReader:
+		return v.Size(), true
+	case interface{ Len() int }:
+		//*bytes.Buffer, *bytes.Reader, *strings.Reader
+		return int64(v.Len()), true
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	default:
+		return 0, false
+	}
+}
+
+// BodyReader returns a reader yielding the content of a response body. Channel bodies can't be read this way.
+func BodyReader(body interface{}) (io.Reader, error) {
+	switch v := body.(type) {
+	case nil:
+		return strings.NewReader(""), nil
+	case string:
+		return strings.NewReader(v), nil
+	case []byte:
+		return bytes.NewReader(v), nil
+	case bytes.Buffer:
+		return bytes.NewReader(v.Bytes()), nil
+	case io.Reader:
+		return v, nil
+	case io.WriterTo:
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := v.WriteTo(pw)
+			_ = pw.CloseWithError(err)
+		}()
+		return pr, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnknownBodyType, body)
+	}
+}
@@ -0,0 +1,199 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteToConnStreamsFileSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("0123456789"), 0o644); err != nil {
+		t.Fatalf("failed creating temp file: %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed opening temp file: %v", err)
+	}
+	body, err := NewFileSection(file, 3, 4)
+	if err != nil {
+		t.Fatalf("NewFileSection() error = %v", err)
+	}
+
+	response := NewResponse()
+	response.Status = StatusPartialContent
+	response.Body = body
+	raw, err := writeResponse(t, response)
+	if err != nil {
+		t.Fatalf("WriteToConn() error = %v", err)
+	}
+	if !strings.HasPrefix(raw, "HTTP/1.1 206 Partial Content\n") || !strings.HasSuffix(raw, "\n\n3456") {
+		t.Errorf("unexpected response %q", raw)
+	}
+	//the response must have closed the file after writing it
+	if _, err := file.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected file to be closed, reading returned %v", err)
+	}
+}
+
+// writeResponse writes response to a pipe and returns everything that arrived on the other end
+func writeResponse(t *testing.T, response *Response) (string, error) {
+	server, client := net.Pipe()
+	defer client.Close()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- response.WriteToConn(server)
+		_ = server.Close()
+	}()
+	raw, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("failed reading response: %v", err)
+	}
+	return string(raw), <-errs
+}
+
+type writerToBody string
+
+func (b writerToBody) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(b))
+	return int64(n), err
+}
+
+func TestWriteToConnBodyTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    interface{}
+		chunked bool
+		want    string
+	}{
+		{"String", "hello", false, "hello"},
+		{"Byte slice", []byte("hello"), false, "hello"},
+		{"Reader", strings.NewReader("hello"), false, "hello"},
+		{"Chunked reader", io.MultiReader(strings.NewReader("hel"), strings.NewReader("lo")), true, "3\r\nhel\r\n2\r\nlo\r\n0\r\n\r\n"},
+		{"WriterTo", writerToBody("hello"), false, "hello"},
+		{"Chunked WriterTo", writerToBody("hello"), true, "5\r\nhello\r\n0\r\n\r\n"},
+		{"Sized reader", NewSizedReader(strings.NewReader("hello world"), 5), false, "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := NewResponse()
+			response.Status = StatusOK
+			response.Body = tt.body
+			if tt.chunked {
+				response.Headers.Set("Transfer-Encoding", "chunked")
+			}
+			raw, err := writeResponse(t, response)
+			if err != nil {
+				t.Fatalf("WriteToConn() error = %v", err)
+			}
+			if _, body, _ := strings.Cut(raw, "\n\n"); body != tt.want {
+				t.Errorf("WriteToConn() body = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteToConnUnknownBodyTypeWritesNothing(t *testing.T) {
+	response := NewResponse()
+	response.Status = StatusOK
+	response.Body = 42
+	raw, err := writeResponse(t, response)
+	if !errors.Is(err, ErrUnknownBodyType) || raw != "" {
+		t.Errorf("WriteToConn() = %q, %v, want nothing written and ErrUnknownBodyType", raw, err)
+	}
+}
+
+func TestSizedReaderShortBody(t *testing.T) {
+	response := NewResponse()
+	response.Status = StatusOK
+	response.Body = NewSizedReader(strings.NewReader("abc"), 5)
+	_, err := writeResponse(t, response)
+	if !errors.Is(err, ErrBodyLengthMismatch) {
+		t.Errorf("WriteToConn() error = %v, want %v", err, ErrBodyLengthMismatch)
+	}
+}
+
+func TestBodyLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   interface{}
+		want   int64
+		wantOk bool
+	}{
+		{"Nil", nil, 0, true},
+		{"String", "abc", 3, true},
+		{"Byte slice", []byte("abcd"), 4, true},
+		{"Buffer", *bytes.NewBufferString("abc"), 3, true},
+		{"Strings reader", strings.NewReader("abcde"), 5, true},
+		{"Sized reader", NewSizedReader(strings.NewReader("abc"), 2), 2, true},
+		{"Unknown reader", io.MultiReader(strings.NewReader("abc")), 0, false},
+		{"Channel", make(chan StreamedResponseChunk), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := BodyLength(tt.body)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("BodyLength() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestWriteToConnOmitBody(t *testing.T) {
+	ch := make(chan StreamedResponseChunk)
+	produced := make(chan struct{})
+	go func() {
+		ch <- StreamedResponseChunk{Data: []byte("one")}
+		ch <- StreamedResponseChunk{Data: []byte("two")}
+		close(ch)
+		close(produced)
+	}()
+	tests := []struct {
+		name string
+		body interface{}
+	}{
+		{"String", "hello"},
+		{"Reader", strings.NewReader("hello")},
+		{"Channel", ch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := NewResponse()
+			response.Status = StatusOK
+			response.Headers.Set("Content-Length", "5")
+			response.Body = tt.body
+			response.OmitBody = true
+			raw, err := writeResponse(t, response)
+			if err != nil {
+				t.Fatalf("WriteToConn() error = %v", err)
+			}
+			if raw != "HTTP/1.1 200 OK\nContent-Length: 5\n\n" {
+				t.Errorf("WriteToConn() = %q, want only status line and headers", raw)
+			}
+		})
+	}
+	select {
+	case <-produced:
+	case <-time.After(time.Second):
+		t.Errorf("expected channel body to be drained")
+	}
+}
+
+func TestDiscardChannelGivesUpOnStalledProducer(t *testing.T) {
+	//the producer sends one chunk and then neither sends nor closes the channel
+	ch := make(chan StreamedResponseChunk)
+	discardChannel(ch, 50*time.Millisecond)
+	ch <- StreamedResponseChunk{Data: []byte("one")}
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case ch <- StreamedResponseChunk{Data: []byte("two")}:
+		t.Errorf("expected DiscardChannel to stop receiving after the timeout")
+	default:
+	}
+}
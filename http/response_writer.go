@@ -0,0 +1,120 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+)
+
+var ErrHeadersAlreadyWritten = fmt.Errorf("response headers were already written")
+var ErrResponseWriterClosed = fmt.Errorf("write on closed response writer")
+
+// ResponseWriter lets handlers stream a response directly to the connection instead of setting Response.Body.
+// The status line and headers are taken from the Response when WriteHeader or the first Write is called, after that
+// changing the Response has no effect. Unless a Content-Length header was set, the body is sent chunked.
+// If Response.OmitBody is set, everything written to the body is discarded.
+// The server closes the writer once the handler returns.
+type ResponseWriter struct {
+	conn          net.Conn
+	response      *Response
+	w             *bufio.Writer
+	body          interface{ Write([]byte) (int, error) }
+	onWriteHeader func()
+	wroteHeader   bool
+	closed        bool
+}
+
+func newResponseWriter(conn net.Conn, response *Response) *ResponseWriter {
+	return &ResponseWriter{conn: conn, response: response}
+}
+
+// OnWriteHeader registers f to be called right before the headers are written, e.g. to add common headers
+func (rw *ResponseWriter) OnWriteHeader(f func()) {
+	rw.onWriteHeader = f
+}
+
+// Started reports whether the headers were written, in which case the response can't be replaced anymore
+func (rw *ResponseWriter) Started() bool {
+	return rw.wroteHeader
+}
+
+// WriteHeader sets the status of the response and writes the status line and headers to the connection
+func (rw *ResponseWriter) WriteHeader(status Status) error {
+	if rw.wroteHeader {
+		return ErrHeadersAlreadyWritten
+	}
+	rw.wroteHeader = true
+	rw.response.Status = status
+	if !rw.response.Headers.Has("Content-Length") {
+		rw.response.AddHeader(Header{Name: "Transfer-Encoding", Value: "chunked"})
+	}
+	if rw.onWriteHeader != nil {
+		rw.onWriteHeader()
+	}
+
+	rw.w = bufio.NewWriter(rw.conn)
+	if rw.response.OmitBody {
+		rw.body = io.Discard
+	} else if rw.response.Headers.ContainsToken("Transfer-Encoding", "chunked") {
+		rw.body = &chunkedWriter{rw.w}
+	} else {
+		rw.body = rw.w
+	}
+	_, err := rw.w.WriteString(fmt.Sprintf("HTTP/1.1 %s\n", rw.response.Status))
+	if err != nil {
+		return err
+	}
+	return rw.response.writeHeaders(rw.w)
+}
+
+// Write writes p as part of the body, writing the headers with the status of the Response (or 200 OK if there is
+// none) first if that didn't happen yet. Data is buffered, use Flush to send it to the client immediately.
+func (rw *ResponseWriter) Write(p []byte) (int, error) {
+	if rw.closed {
+		return 0, ErrResponseWriterClosed
+	}
+	if !rw.wroteHeader {
+		status := rw.response.Status
+		if status == "" {
+			status = StatusOK
+		}
+		err := rw.WriteHeader(status)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return rw.body.Write(p)
+}
+
+// Flush sends everything written so far to the client
+func (rw *ResponseWriter) Flush() error {
+	if rw.closed {
+		return ErrResponseWriterClosed
+	}
+	if !rw.wroteHeader {
+		_, err := rw.Write(nil)
+		if err != nil {
+			return err
+		}
+	}
+	return rw.w.Flush()
+}
+
+// Close finishes the response by terminating a chunked body and flushing everything to the client
+func (rw *ResponseWriter) Close() error {
+	if rw.closed {
+		return nil
+	}
+	rw.closed = true
+	if !rw.wroteHeader {
+		return nil
+	}
+	if cw, ok := rw.body.(*chunkedWriter); ok {
+		err := cw.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return rw.w.Flush()
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// captureWriter runs write with a ResponseWriter on a pipe and returns everything that arrived on the other end
+func captureWriter(t *testing.T, write func(rw *ResponseWriter, response *Response)) string {
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		response := NewResponse()
+		rw := newResponseWriter(server, response)
+		write(rw, response)
+		_ = rw.Close()
+		_ = server.Close()
+	}()
+	raw, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("failed reading response: %v", err)
+	}
+	return string(raw)
+}
+
+func TestResponseWriterChunked(t *testing.T) {
+	raw := captureWriter(t, func(rw *ResponseWriter, response *Response) {
+		response.Headers.Set("Content-Type", "text/csv")
+		rw.OnWriteHeader(func() { response.Headers.Set("Server", "test") })
+		_, _ = rw.Write([]byte("a,b\n"))
+		_ = rw.Flush()
+		_, _ = rw.Write([]byte("1,2\n"))
+		response.Headers.Set("X-Too-Late", "ignored")
+	})
+	want := "HTTP/1.1 200 OK\nContent-Type: text/csv\nServer: test\nTransfer-Encoding: chunked\n\n" +
+		"4\r\na,b\n\r\n4\r\n1,2\n\r\n0\r\n\r\n"
+	if raw != want {
+		t.Errorf("unexpected response %q, want %q", raw, want)
+	}
+}
+
+func TestResponseWriterWithContentLength(t *testing.T) {
+	raw := captureWriter(t, func(rw *ResponseWriter, response *Response) {
+		response.Headers.Set("Content-Length", "5")
+		if err := rw.WriteHeader(StatusCreated); err != nil {
+			t.Errorf("WriteHeader() error = %v", err)
+		}
+		if err := rw.WriteHeader(StatusOK); !errors.Is(err, ErrHeadersAlreadyWritten) {
+			t.Errorf("second WriteHeader() error = %v, want %v", err, ErrHeadersAlreadyWritten)
+		}
+		_, _ = rw.Write([]byte("hello"))
+	})
+	if raw != "HTTP/1.1 201 Created\nContent-Length: 5\n\nhello" {
+		t.Errorf("unexpected response %q", raw)
+	}
+}
+
+func TestResponseWriterUnused(t *testing.T) {
+	raw := captureWriter(t, func(rw *ResponseWriter, response *Response) {
+		if rw.Started() {
+			t.Errorf("expected unused writer not to be started")
+		}
+	})
+	if raw != "" {
+		t.Errorf("expected unused writer to write nothing, got %q", raw)
+	}
+}
+
+func TestResponseWriterWriteAfterClose(t *testing.T) {
+	raw := captureWriter(t, func(rw *ResponseWriter, response *Response) {
+		_, _ = rw.Write([]byte("x"))
+		_ = rw.Close()
+		if _, err := rw.Write([]byte("y")); !errors.Is(err, ErrResponseWriterClosed) {
+			t.Errorf("Write() after Close() error = %v, want %v", err, ErrResponseWriterClosed)
+		}
+	})
+	if !strings.HasSuffix(raw, "1\r\nx\r\n0\r\n\r\n") {
+		t.Errorf("unexpected response %q", raw)
+	}
+}
@@ -1,6 +1,33 @@
 package http
 
+import "time"
+
+// bodyChannelTimeout is how long to wait for the next chunk of a channel body before giving up on it
+const bodyChannelTimeout = 15 * time.Second //TODO: make configurable
+
 type StreamedResponseChunk struct {
 	Data []byte
 	Err  error
 }
+
+// DiscardChannel receives and drops the chunks of a channel body that won't be sent in the background, so its producer
+// doesn't block forever. Like sending the body, it gives up once no chunk arrived for a while, so a producer that never
+// closes the channel doesn't leak the goroutine.
+func DiscardChannel(c chan StreamedResponseChunk) {
+	discardChannel(c, bodyChannelTimeout)
+}
+
+func discardChannel(c chan StreamedResponseChunk, timeout time.Duration) {
+	go func() {
+		for {
+			select {
+			case _, more := <-c:
+				if !more {
+					return
+				}
+			case <-time.After(timeout):
+				return
+			}
+		}
+	}()
+}
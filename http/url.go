@@ -0,0 +1,116 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// URL is the parsed request target of a request
+type URL struct {
+	// Path is the percent-decoded and normalized path, this is what routes are matched against
+	Path string
+	// RawPath is the path exactly as the client sent it
+	RawPath string
+	// RawQuery is the query string without the leading question mark, exactly as the client sent it
+	RawQuery string
+	Query    Query
+}
+
+// Query holds the decoded parameters of a query string, a parameter may occur multiple times
+type Query map[string][]string
+
+// Get returns the first value of the query parameter key, or an empty string if there is none
+func (q Query) Get(key string) string {
+	if values := q[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns all values of the query parameter key in the order they appeared in
+func (q Query) Values(key string) []string {
+	return q[key]
+}
+
+// Has reports whether the query parameter key is present, even if it has no value
+func (q Query) Has(key string) bool {
+	_, ok := q[key]
+	return ok
+}
+
+var ErrInvalidRequestTarget = fmt.Errorf("%w: invalid request target", ErrInvalidRequest)
+
+// ParseRequestTarget parses the request target of a request line. Besides the usual origin-form (/path?query),
+// the asterisk-form (*) and the absolute-form (http://host/path?query) are supported. Paths containing an encoded
+// slash (%2F) are rejected.
+func ParseRequestTarget(target string) (*URL, error) {
+	if target == "*" {
+		return &URL{Path: "*", RawPath: "*", Query: Query{}}, nil
+	}
+	if i := strings.Index(target, "://"); i > 0 && !strings.Contains(target[:i], "/") {
+		//absolute-form, we only care about the path and query
+		rest := target[i+3:]
+		slash := strings.IndexAny(rest, "/?")
+		if slash == -1 {
+			target = "/"
+		} else {
+			target = rest[slash:]
+			if target[0] == '?' {
+				target = "/" + target
+			}
+		}
+	}
+	if !strings.HasPrefix(target, "/") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRequestTarget, target)
+	}
+	//fragments are never sent by well-behaved clients, drop them if they are
+	target, _, _ = strings.Cut(target, "#")
+	rawPath, rawQuery, _ := strings.Cut(target, "?")
+
+	//a decoded %2F couldn't be told apart from a real separator, so it could change which route matches the path
+	if strings.Contains(strings.ToUpper(rawPath), "%2F") {
+		return nil, fmt.Errorf("%w: path contains encoded slash", ErrInvalidRequestTarget)
+	}
+	decoded, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequestTarget, err)
+	}
+	if strings.IndexByte(decoded, 0) != -1 {
+		return nil, fmt.Errorf("%w: path contains NUL byte", ErrInvalidRequestTarget)
+	}
+	query, err := ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	return &URL{Path: NormalizePath(decoded), RawPath: rawPath, RawQuery: rawQuery, Query: query}, nil
+}
+
+// ParseQuery decodes a query string into its parameters
+func ParseQuery(rawQuery string) (Query, error) {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid query: %v", ErrInvalidRequestTarget, err)
+	}
+	return Query(values), nil
+}
+
+// NormalizePath removes dot segments and duplicate slashes from p, so that p can never point above the root.
+// A trailing slash is preserved, since routes may distinguish between /dir and /dir/.
+func NormalizePath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// EscapePath percent-encodes every segment of the path p, keeping the slashes between them
+func EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
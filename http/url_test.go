@@ -0,0 +1,91 @@
+package http
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRequestTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    *URL
+		wantErr bool
+	}{
+		{"Root", "/", &URL{"/", "/", "", Query{}}, false},
+		{"Plain path", "/search", &URL{"/search", "/search", "", Query{}}, false},
+		{"Query", "/search?q=x", &URL{"/search", "/search", "q=x", Query{"q": {"x"}}}, false},
+		{"Multi-valued query", "/s?tag=a&tag=b&empty", &URL{"/s", "/s", "tag=a&tag=b&empty",
+			Query{"tag": {"a", "b"}, "empty": {""}}}, false},
+		{"Encoded query", "/s?q=hello+world%21&k%20ey=v", &URL{"/s", "/s", "q=hello+world%21&k%20ey=v",
+			Query{"q": {"hello world!"}, "k ey": {"v"}}}, false},
+		{"Percent-encoded path", "/my%20file.txt", &URL{"/my file.txt", "/my%20file.txt", "", Query{}}, false},
+		{"Plus in path is no space", "/a+b", &URL{"/a+b", "/a+b", "", Query{}}, false},
+		{"Dot segments", "/a/../b", &URL{"/b", "/a/../b", "", Query{}}, false},
+		{"Encoded dot segments", "/a/%2e%2e/b", &URL{"/b", "/a/%2e%2e/b", "", Query{}}, false},
+		{"Dot segments above root", "/../../etc/passwd", &URL{"/etc/passwd", "/../../etc/passwd", "", Query{}}, false},
+		{"Current dir segments", "/a/./b/.", &URL{"/a/b", "/a/./b/.", "", Query{}}, false},
+		{"Duplicate slashes", "//a///b", &URL{"/a/b", "//a///b", "", Query{}}, false},
+		{"Trailing slash is kept", "/dir/", &URL{"/dir/", "/dir/", "", Query{}}, false},
+		{"Fragment is dropped", "/a#frag", &URL{"/a", "/a", "", Query{}}, false},
+		{"Asterisk-form", "*", &URL{"*", "*", "", Query{}}, false},
+		{"Absolute-form", "http://example.com/a/b?c=d", &URL{"/a/b", "/a/b", "c=d", Query{"c": {"d"}}}, false},
+		{"Absolute-form without path", "http://example.com", &URL{"/", "/", "", Query{}}, false},
+		{"Absolute-form without path with query", "http://example.com?a=b", &URL{"/", "/", "a=b", Query{"a": {"b"}}}, false},
+		{"Relative path", "search", nil, true},
+		{"Invalid escape in path", "/a%zz", nil, true},
+		{"Encoded NUL byte", "/a%00b", nil, true},
+		{"Encoded slash", "/a%2F..%2Fb", nil, true},
+		{"Lowercase encoded slash", "/files/a%2fb", nil, true},
+		{"Invalid escape in query", "/a?q=%zz", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRequestTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRequestTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRequestTarget() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryAccessors(t *testing.T) {
+	q := Query{"tag": {"a", "b"}, "empty": {""}}
+	if got := q.Get("tag"); got != "a" {
+		t.Errorf("Get(tag) = %q, want %q", got, "a")
+	}
+	if got := q.Values("tag"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Values(tag) = %v, want [a b]", got)
+	}
+	if got := q.Get("missing"); got != "" {
+		t.Errorf("Get(missing) = %q, want empty string", got)
+	}
+	if !q.Has("empty") || q.Has("missing") {
+		t.Errorf("Has() reports wrong presence of parameters")
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"/docs/index.html", "/docs/index.html"},
+		{"/my files/a#b?.txt", "/my%20files/a%23b%3F.txt"},
+		{"/100%/ü", "/100%25/%C3%BC"},
+	}
+	for _, tt := range tests {
+		if got := EscapePath(tt.path); got != tt.want {
+			t.Errorf("EscapePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+		//escaping must round-trip through the request target parser
+		u, err := ParseRequestTarget(EscapePath(tt.path))
+		if err != nil || u.Path != tt.path {
+			t.Errorf("ParseRequestTarget(EscapePath(%q)) = %v, %v", tt.path, u, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -24,29 +25,34 @@ func GetHttpPathForFilepath(filepath string) string {
 	return "/" + fp
 }
 
+// ParseAcceptedQValues parses a header like Accept-Encoding into its values and their q values. Values are lowercased,
+// values without a q parameter get a q value of 1 and parameters other than q are ignored.
+// An error is returned if a q value isn't a number between 0 and 1.
 func ParseAcceptedQValues(s string) (map[string]float64, error) {
 	retval := make(map[string]float64)
 	parts := strings.Split(s, ",")
 	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if part == "" {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
 			continue
 		}
-		kv := strings.Split(part, ";")
-		if len(kv) == 1 {
-			retval[kv[0]] = 1.0
-		} else if len(kv) == 2 {
-			//parse q value
-			s = strings.TrimSpace(kv[1])
-			s = strings.TrimPrefix(s, "q=")
-			f, err := strconv.ParseFloat(s, 64)
+		q := 1.0
+		for _, param := range params[1:] {
+			name, v, _ := strings.Cut(param, "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
 			if err != nil {
 				return nil, err
 			}
-			retval[kv[0]] = f
-		} else {
-			panic("error reading accepted values in header")
+			if f < 0 || f > 1 {
+				return nil, fmt.Errorf("q value %v of %s out of range", f, value)
+			}
+			q = f
 		}
+		retval[value] = q
 	}
 	return retval, nil
 }
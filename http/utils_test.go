@@ -50,6 +50,10 @@ func TestParseAcceptedQValues(t *testing.T) {
 		{"Valid entry with q value", args{"deflate;q=0.3"}, map[string]float64{"deflate": 0.3}, false},
 		{"Multiple entries", args{"deflate, gzip, br"}, map[string]float64{"deflate": 1.0, "gzip": 1.0, "br": 1.0}, false},
 		{"Multiple entries with q values", args{"deflate;q=1.0, gzip;q=0.3, br;q=0.1"}, map[string]float64{"deflate": 1.0, "gzip": 0.3, "br": 0.1}, false},
+		{"Additional parameters", args{"gzip;q=0.5;foo=bar, br;level=3"}, map[string]float64{"gzip": 0.5, "br": 1.0}, false},
+		{"Whitespace and case", args{" GZIP ; Q=0 ,*;q=0.2"}, map[string]float64{"gzip": 0, "*": 0.2}, false},
+		{"Invalid q value", args{"gzip;q=high"}, nil, true},
+		{"Q value out of range", args{"gzip;q=2"}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
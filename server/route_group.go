@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"gophttp/handlers"
+	"gophttp/http"
+	"slices"
+	"strings"
+)
+
+// RouteGroup registers handlers on a Router below a common path prefix, wrapping each of them into the middlewares
+// shared by the group
+type RouteGroup struct {
+	router      *Router
+	prefix      string
+	middlewares []handlers.Middleware
+}
+
+// With returns a route group whose handlers are wrapped into middlewares, the first middleware runs first.
+// This is how middleware is applied to single routes, e.g. r.With(auth).AddHandler("/admin", http.GET, h).
+func (r *Router) With(middlewares ...handlers.Middleware) *RouteGroup {
+	return &RouteGroup{router: r, middlewares: slices.Clone(middlewares)}
+}
+
+// Group returns a route group registering its routes relative to prefix, e.g. AddHandler("/users", ...) on
+// Group("/api/v1") registers /api/v1/users. Its handlers are wrapped into middlewares.
+func (r *Router) Group(prefix string, middlewares ...handlers.Middleware) *RouteGroup {
+	return &RouteGroup{router: r, prefix: strings.TrimSuffix(prefix, "/"), middlewares: slices.Clone(middlewares)}
+}
+
+// Mount adds all routes of sub to r below prefix, keeping the handlers registered for every method of a route and the
+// names of named routes. The routes sub has at the time of mounting are copied, later changes to sub don't affect r.
+// If r already has a handler for a method of one of the routes, nothing is mounted and ErrDuplicateRoute is returned.
+// Route names stay the same when mounting, so a router with named routes can only be mounted once, mounting it again
+// returns ErrDuplicateRouteName.
+func (r *Router) Mount(prefix string, sub *Router) error {
+	return r.mount(strings.TrimSuffix(prefix, "/"), sub, nil)
+}
+
+func (r *Router) mount(prefix string, sub *Router, middlewares []handlers.Middleware) error {
+	subRoutes := sub.routes.Load()
+	return r.update(func(routes *routeTable) error {
+		for pattern, collection := range subRoutes.tree.Walk() {
+			for _, method := range collection.Methods() {
+				//mounted routers are often built independently, so replacing a handler is most likely a mistake
+				if existing, err := routes.tree.FindPattern(prefix + pattern); err == nil && existing.GetRoute(method) != nil {
+					return fmt.Errorf("failed mounting %s below %s: %w: %s %s", pattern, prefix, ErrDuplicateRoute, method, prefix+pattern)
+				}
+				handler := handlers.Chain(collection.GetRoute(method), middlewares...)
+				err := insertRoute(routes.tree, prefix+pattern, method, handler)
+				if err != nil {
+					return fmt.Errorf("failed mounting %s below %s: %w", pattern, prefix, err)
+				}
+			}
+		}
+		for name, pattern := range subRoutes.names {
+			err := nameRoute(routes, name, prefix+pattern)
+			if err != nil {
+				return fmt.Errorf("failed mounting %s below %s: %w", pattern, prefix, err)
+			}
+		}
+		return nil
+	})
+}
+
+// With returns a nested group, whose handlers are wrapped into the middlewares of g first and then into middlewares
+func (g *RouteGroup) With(middlewares ...handlers.Middleware) *RouteGroup {
+	return &RouteGroup{router: g.router, prefix: g.prefix, middlewares: slices.Concat(g.middlewares, middlewares)}
+}
+
+// Group returns a nested group below the prefix of g, see Router.Group
+func (g *RouteGroup) Group(prefix string, middlewares ...handlers.Middleware) *RouteGroup {
+	return &RouteGroup{
+		router:      g.router,
+		prefix:      g.prefix + strings.TrimSuffix(prefix, "/"),
+		middlewares: slices.Concat(g.middlewares, middlewares),
+	}
+}
+
+// Use adds middlewares to the group, they only apply to handlers added afterwards
+func (g *RouteGroup) Use(middlewares ...handlers.Middleware) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+// AddHandler registers handler for route relative to the prefix of the group, wrapped into the middlewares of the
+// group, see Router.AddHandler
+func (g *RouteGroup) AddHandler(route string, method http.Method, handler handlers.Handler) error {
+	return g.router.AddHandler(g.prefix+route, method, handlers.Chain(handler, g.middlewares...))
+}
+
+// AddNamedHandler registers handler like AddHandler and names the route, see Router.AddNamedHandler
+func (g *RouteGroup) AddNamedHandler(name string, route string, method http.Method, handler handlers.Handler) error {
+	return g.router.AddNamedHandler(name, g.prefix+route, method, handlers.Chain(handler, g.middlewares...))
+}
+
+// Mount adds all routes of sub below prefix relative to the prefix of the group, wrapping them into the middlewares of
+// the group, see Router.Mount
+func (g *RouteGroup) Mount(prefix string, sub *Router) error {
+	return g.router.mount(g.prefix+strings.TrimSuffix(prefix, "/"), sub, g.middlewares)
+}
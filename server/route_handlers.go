@@ -3,12 +3,19 @@ package server
 import (
 	"gophttp/handlers"
 	"gophttp/http"
+	"maps"
+	"slices"
+	"strings"
 )
 
 type RouteHandlerCollection interface {
 	GetRoute(method http.Method) handlers.Handler
 	DeleteRoute(method http.Method)
 	InsertRoute(method http.Method, handler handlers.Handler)
+	// Methods returns the methods handlers are registered for, in the order they are declared in the http package
+	Methods() []http.Method
+	Empty() bool
+	Clone() RouteHandlerCollection
 }
 
 type routeHandlers struct {
@@ -30,3 +37,33 @@ func (r routeHandlers) DeleteRoute(method http.Method) {
 func (r routeHandlers) InsertRoute(method http.Method, handler handlers.Handler) {
 	r.handlers[method] = handler
 }
+
+func (r routeHandlers) Methods() []http.Method {
+	return slices.Sorted(maps.Keys(r.handlers))
+}
+
+func (r routeHandlers) Empty() bool {
+	return len(r.handlers) == 0
+}
+
+func (r routeHandlers) Clone() RouteHandlerCollection {
+	return &routeHandlers{handlers: maps.Clone(r.handlers)}
+}
+
+// allowedMethods returns the value of the Allow header for a route, which includes the methods the server answers
+// automatically: HEAD for routes with a GET handler and OPTIONS for every route
+func allowedMethods(routes RouteHandlerCollection) string {
+	methods := routes.Methods()
+	if slices.Contains(methods, http.GET) {
+		methods = append(methods, http.HEAD)
+	}
+	methods = append(methods, http.OPTIONS)
+	slices.Sort(methods)
+	methods = slices.Compact(methods)
+
+	names := make([]string, len(methods))
+	for i, method := range methods {
+		names[i] = method.String()
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"gophttp/common"
+	"gophttp/handlers"
+	"gophttp/http"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrUnknownRouteName = fmt.Errorf("unknown route name")
+var ErrDuplicateRouteName = fmt.Errorf("duplicate route name")
+var ErrMissingRouteParam = fmt.Errorf("missing route parameter")
+var ErrDuplicateRoute = fmt.Errorf("duplicate route")
+
+type routeTree = common.RadixTree[RouteHandlerCollection]
+
+// routeTable is a snapshot of the routes of a Router
+type routeTable struct {
+	tree *routeTree
+	//names maps the name of a named route to its pattern
+	names map[string]string
+}
+
+func (t *routeTable) clone() *routeTable {
+	return &routeTable{tree: t.tree.Clone(RouteHandlerCollection.Clone), names: maps.Clone(t.names)}
+}
+
+// Router holds a route table. Lookups read an immutable snapshot of the table and never block, modifications copy
+// the current snapshot, change the copy and then publish it atomically. This makes it safe to change routes while
+// requests are being served.
+type Router struct {
+	routes atomic.Pointer[routeTable]
+	//serializes writers, so no modification is lost when two of them copy the same snapshot
+	muWrite sync.Mutex
+}
+
+func NewRouter() *Router {
+	r := &Router{}
+	r.routes.Store(&routeTable{tree: common.NewRadixTree[RouteHandlerCollection](), names: make(map[string]string)})
+	return r
+}
+
+// Find returns the handlers registered for the route matching path together with the path parameters of the match
+func (r *Router) Find(path string) (RouteHandlerCollection, map[string]string, error) {
+	return r.routes.Load().tree.FindWithParams(path)
+}
+
+// update applies f to a copy of the current route table and publishes the copy if f succeeds
+func (r *Router) update(f func(routes *routeTable) error) error {
+	r.muWrite.Lock()
+	defer r.muWrite.Unlock()
+	routes := r.routes.Load().clone()
+	err := f(routes)
+	if err != nil {
+		return err
+	}
+	r.routes.Store(routes)
+	return nil
+}
+
+// AddFileRoutes searches for all files and directories under path and adds a handler for each of them to the router.
+// Files are compressed according to handlers.DefaultCompressionPolicy.
+func (r *Router) AddFileRoutes(path string) error {
+	return r.AddFileRoutesWithOptions(path, handlers.CompressionOptions{})
+}
+
+// AddFileRoutesWithOptions adds file routes like AddFileRoutes, compressing the files according to options, e.g.
+// which types are compressed (see handlers.CompressionPolicy)
+func (r *Router) AddFileRoutesWithOptions(path string, options handlers.CompressionOptions) error {
+	compress := handlers.CompressWith(options)
+	files, err := common.ListFilesRecursive(path)
+	if err != nil {
+		panic(err)
+	}
+	dirs, err := common.ListDirsRecursive(path)
+	if err != nil {
+		panic(err)
+	}
+
+	return r.update(func(routes *routeTable) error {
+		for _, file := range files {
+			joined := filepath.Join(path, file)
+			err = addFileRoute(routes.tree, joined, compress)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, dir := range dirs {
+			joined := filepath.Join(path, dir)
+			err = addDirRoute(routes.tree, joined)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddStaticRoutes serves all files and directories under dir below the route prefix using a single catch-all route.
+// Unlike AddFileRoutes, dir is not scanned up front, so files created later are served without re-adding routes.
+// Files are compressed according to handlers.DefaultCompressionPolicy.
+func (r *Router) AddStaticRoutes(prefix string, dir string) error {
+	return r.AddStaticRoutesWithOptions(prefix, dir, handlers.CompressionOptions{})
+}
+
+// AddStaticRoutesWithOptions adds static routes like AddStaticRoutes, compressing the files according to options
+func (r *Router) AddStaticRoutesWithOptions(prefix string, dir string, options handlers.CompressionOptions) error {
+	prefix = strings.TrimSuffix(prefix, "/")
+	compress := handlers.CompressWith(options)
+	return r.update(func(routes *routeTable) error {
+		h := handlers.Chain(handlers.NewStaticDirectoryHandler(dir, "filepath"), compress)
+		if prefix != "" {
+			//also serve the directory itself when the prefix is requested without a trailing slash
+			err := insertRoute(routes.tree, prefix, http.GET, h)
+			if err != nil {
+				return err
+			}
+		}
+		return insertRoute(routes.tree, prefix+"/*filepath", http.GET, h)
+	})
+}
+
+// AddHandler registers handler for requests with the given method on route. Segments of route starting with a colon
+// (e.g. /users/:id) match any single path segment, a last segment starting with an asterisk (e.g. /static/*filepath)
+// matches the rest of the path. The matched values are available to the handler via ctx.Param.
+func (r *Router) AddHandler(route string, method http.Method, handler handlers.Handler) error {
+	if route == "" {
+		return fmt.Errorf("invalid route: can't be empty string")
+	}
+	return r.update(func(routes *routeTable) error {
+		return insertRoute(routes.tree, route, method, handler)
+	})
+}
+
+// AddNamedHandler registers handler like AddHandler and names the route, so URLFor can build paths to it. A route
+// keeps its name for all methods, the same name can't be given to two different routes.
+func (r *Router) AddNamedHandler(name string, route string, method http.Method, handler handlers.Handler) error {
+	if route == "" {
+		return fmt.Errorf("invalid route: can't be empty string")
+	}
+	return r.update(func(routes *routeTable) error {
+		err := nameRoute(routes, name, route)
+		if err != nil {
+			return err
+		}
+		return insertRoute(routes.tree, route, method, handler)
+	})
+}
+
+// URLFor builds the path of the route called name, replacing its path variables with the percent-encoded values in
+// params. An error is returned if there is no such route or a value for one of its variables is missing.
+func (r *Router) URLFor(name string, params map[string]string) (string, error) {
+	pattern, ok := r.routes.Load().names[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownRouteName, name)
+	}
+	return buildURL(pattern, params)
+}
+
+// RemoveHandler removes the handler for method from route. If route has no handlers left, it is removed entirely.
+func (r *Router) RemoveHandler(route string, method http.Method) error {
+	return r.update(func(routes *routeTable) error {
+		n, err := routes.tree.FindPattern(route)
+		if err != nil {
+			return fmt.Errorf("failed removing handler from %s: %w", route, err)
+		}
+		if n.GetRoute(method) == nil {
+			return fmt.Errorf("failed removing handler from %s: %w: no handler for %s", route, common.ErrNoMatch, method)
+		}
+		n.DeleteRoute(method)
+		if n.Empty() {
+			return deleteRoute(routes, route)
+		}
+		return nil
+	})
+}
+
+// RemoveRoute removes route and all of its handlers from the router
+func (r *Router) RemoveRoute(route string) error {
+	return r.update(func(routes *routeTable) error {
+		return deleteRoute(routes, route)
+	})
+}
+
+// deleteRoute removes route from the table, together with its name
+func deleteRoute(routes *routeTable, route string) error {
+	err := routes.tree.Delete(route)
+	if err != nil {
+		return fmt.Errorf("failed removing route %s: %w", route, err)
+	}
+	maps.DeleteFunc(routes.names, func(_ string, pattern string) bool {
+		return pattern == route
+	})
+	return nil
+}
+
+// nameRoute gives route the name name, unless the name already belongs to another route
+func nameRoute(routes *routeTable, name string, route string) error {
+	if name == "" {
+		return fmt.Errorf("invalid route name: can't be empty string")
+	}
+	if existing, ok := routes.names[name]; ok && existing != route {
+		return fmt.Errorf("%w: %s already names %s", ErrDuplicateRouteName, name, existing)
+	}
+	routes.names[name] = route
+	return nil
+}
+
+func insertRoute(routes *routeTree, route string, method http.Method, handler handlers.Handler) error {
+	n, err := routes.FindPattern(route)
+	if err == nil {
+		//route already exists, just add the handler for the method
+		n.InsertRoute(method, handler)
+		return nil
+	}
+	if !errors.Is(err, common.ErrNoMatch) {
+		return err
+	}
+	n = NewRouteHandlers()
+	n.InsertRoute(method, handler)
+	return routes.Insert(route, n)
+}
+
+func addFileRoute(routes *routeTree, file string, compress handlers.Middleware) error {
+	path := http.GetHttpPathForFilepath(file)
+	fh := handlers.NewFileHandler(file)
+	h := handlers.Chain(fh, compress)
+	err := insertRoute(routes, path, http.GET, h)
+	return err
+}
+
+func addDirRoute(routes *routeTree, dir string) error {
+	path := http.GetHttpPathForFilepath(dir)
+	handler, err := handlers.NewDirectoryHandler(dir)
+	if err != nil {
+		return err
+	}
+	err = insertRoute(routes, path, http.GET, handler)
+	return err
+}
+
+// buildURL replaces the variables and the catch-all of pattern with the values in params and percent-encodes the result
+func buildURL(pattern string, params map[string]string) (string, error) {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			value := params[segment[1:]]
+			if value == "" {
+				//variables never match empty segments, so there is no path for an empty value
+				return "", fmt.Errorf("%w: %s in %s", ErrMissingRouteParam, segment[1:], pattern)
+			}
+			segments[i] = url.PathEscape(value)
+		case strings.HasPrefix(segment, "*"):
+			name := segment[1:]
+			if name == "" {
+				name = "*"
+			}
+			value, ok := params[name]
+			if !ok {
+				return "", fmt.Errorf("%w: %s in %s", ErrMissingRouteParam, name, pattern)
+			}
+			//the catch-all may span several segments, only their contents are escaped
+			segments[i] = http.EscapePath(strings.TrimPrefix(value, "/"))
+		default:
+			segments[i] = url.PathEscape(segment)
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
@@ -0,0 +1,411 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"gophttp/handlers"
+	"gophttp/http"
+	"gophttp/server"
+)
+
+var noopHandler = handlers.HandlerFunc(func(ctx http.Context) error { return nil })
+
+// TestRouterConcurrentUpdates adds and removes routes while other goroutines keep looking up routes,
+// run with -race to detect unsynchronized access to the route table
+func TestRouterConcurrentUpdates(t *testing.T) {
+	httpServer := server.NewHttpServer(0)
+	if err := httpServer.AddHandler("/stable/:id", http.GET, noopHandler); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+
+	const writers = 4
+	const iterations = 200
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				routes, params, err := httpServer.Router().Find("/stable/42")
+				if err != nil || routes.GetRoute(http.GET) == nil || params["id"] != "42" {
+					t.Errorf("stable route vanished during updates: %v", err)
+					return
+				}
+				_, _, _ = httpServer.Router().Find("/dynamic/1/3")
+			}
+		}()
+	}
+
+	var writersWG sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		writersWG.Add(1)
+		go func() {
+			defer writersWG.Done()
+			for i := 0; i < iterations; i++ {
+				route := fmt.Sprintf("/dynamic/%d/%d", w, i)
+				if err := httpServer.AddHandler(route, http.GET, noopHandler); err != nil {
+					t.Errorf("failed adding %s: %v", route, err)
+					return
+				}
+				if err := httpServer.AddHandler(route, http.POST, noopHandler); err != nil {
+					t.Errorf("failed adding %s: %v", route, err)
+					return
+				}
+				if err := httpServer.RemoveHandler(route, http.GET); err != nil {
+					t.Errorf("failed removing handler from %s: %v", route, err)
+					return
+				}
+				if i%2 == 0 {
+					if err := httpServer.RemoveRoute(route); err != nil {
+						t.Errorf("failed removing %s: %v", route, err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	writersWG.Wait()
+	close(done)
+	readers.Wait()
+
+	for w := 0; w < writers; w++ {
+		for i := 0; i < iterations; i++ {
+			routes, _, err := httpServer.Router().Find(fmt.Sprintf("/dynamic/%d/%d", w, i))
+			if i%2 == 0 && err == nil {
+				t.Errorf("expected /dynamic/%d/%d to be removed", w, i)
+			}
+			if i%2 == 1 && (err != nil || routes.GetRoute(http.POST) == nil || routes.GetRoute(http.GET) != nil) {
+				t.Errorf("expected only POST handler on /dynamic/%d/%d, err: %v", w, i, err)
+			}
+		}
+	}
+}
+
+func TestSwapRouter(t *testing.T) {
+	httpServer := server.NewHttpServer(0)
+	if err := httpServer.AddHandler("/old", http.GET, noopHandler); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+
+	router := server.NewRouter()
+	if err := router.AddHandler("/new", http.GET, noopHandler); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			router := httpServer.Router()
+			_, _, errOld := router.Find("/old")
+			_, _, errNew := router.Find("/new")
+			if (errOld == nil) == (errNew == nil) {
+				t.Errorf("expected exactly one of the route tables to be active")
+				return
+			}
+		}
+	}()
+	old := httpServer.SwapRouter(router)
+	wg.Wait()
+
+	if _, _, err := old.Find("/old"); err != nil {
+		t.Errorf("expected previous router to be returned, got error %v", err)
+	}
+	if _, _, err := httpServer.Router().Find("/new"); err != nil {
+		t.Errorf("expected new router to be active, got error %v", err)
+	}
+}
+
+// taggingMiddleware appends name to the X-Middlewares header of the response, so tests can see which middlewares ran
+func taggingMiddleware(name string) handlers.Middleware {
+	return func(next handlers.Handler) handlers.Handler {
+		return handlers.HandlerFunc(func(ctx http.Context) error {
+			ctx.Response.Headers.Add("X-Middlewares", name)
+			return next.HandleRequest(ctx)
+		})
+	}
+}
+
+// serve looks up the request target in router and runs the handler for method, returning the response
+func serve(t *testing.T, router *server.Router, method http.Method, target string) *http.Response {
+	u, err := http.ParseRequestTarget(target)
+	if err != nil {
+		t.Fatalf("ParseRequestTarget(%s) error = %v", target, err)
+	}
+	path := u.Path
+	routes, params, err := router.Find(path)
+	if err != nil {
+		t.Fatalf("Find(%s) error = %v", path, err)
+	}
+	handler := routes.GetRoute(method)
+	if handler == nil {
+		t.Fatalf("no %s handler for %s", method, path)
+	}
+	ctx := http.NewContext(nil, 0)
+	ctx.Request = &http.Request{Method: method, Path: path, URL: u, Headers: make(http.Headers)}
+	ctx.Params = params
+	if err := handler.HandleRequest(ctx); err != nil {
+		t.Fatalf("handler for %s failed: %v", path, err)
+	}
+	return ctx.Response
+}
+
+func TestRouteGroupsAndMount(t *testing.T) {
+	echo := func(text string) handlers.Handler {
+		return handlers.HandlerFunc(func(ctx http.Context) error {
+			ctx.Response.Body = fmt.Sprintf("%s %v", text, ctx.Params)
+			return nil
+		})
+	}
+
+	router := server.NewRouter()
+	api := router.Group("/api/v1/", taggingMiddleware("v1"))
+	if err := api.AddHandler("/users/:id", http.GET, echo("user")); err != nil {
+		t.Fatalf("failed adding handler: %v", err)
+	}
+	admin := api.Group("/admin", taggingMiddleware("admin"))
+	if err := admin.AddHandler("/stats", http.GET, echo("stats")); err != nil {
+		t.Fatalf("failed adding handler: %v", err)
+	}
+
+	shop := server.NewRouter()
+	for _, route := range []struct {
+		route  string
+		method http.Method
+	}{{"/items", http.GET}, {"/items", http.POST}, {"/items/:id", http.GET}} {
+		if err := shop.AddHandler(route.route, route.method, echo(route.method.String()+" "+route.route)); err != nil {
+			t.Fatalf("failed adding handler: %v", err)
+		}
+	}
+	if err := router.Mount("/shop", shop); err != nil {
+		t.Fatalf("failed mounting router: %v", err)
+	}
+	if err := api.Mount("/shop/", shop); err != nil {
+		t.Fatalf("failed mounting router in group: %v", err)
+	}
+	//changes after mounting don't show up in the mounted copy
+	if err := shop.AddHandler("/later", http.GET, echo("later")); err != nil {
+		t.Fatalf("failed adding handler: %v", err)
+	}
+
+	tests := []struct {
+		method          http.Method
+		path            string
+		wantBody        string
+		wantMiddlewares []string
+	}{
+		{http.GET, "/api/v1/users/42", "user map[id:42]", []string{"v1"}},
+		{http.GET, "/api/v1/admin/stats", "stats map[]", []string{"v1", "admin"}},
+		{http.GET, "/shop/items", "GET /items map[]", nil},
+		{http.POST, "/shop/items", "POST /items map[]", nil},
+		{http.GET, "/shop/items/7", "GET /items/:id map[id:7]", nil},
+		{http.POST, "/api/v1/shop/items", "POST /items map[]", []string{"v1"}},
+	}
+	for _, tt := range tests {
+		response := serve(t, router, tt.method, tt.path)
+		if response.Body != tt.wantBody {
+			t.Errorf("%s %s: body = %q, want %q", tt.method, tt.path, response.Body, tt.wantBody)
+		}
+		if got := response.Headers.Values("X-Middlewares"); !slices.Equal(got, tt.wantMiddlewares) {
+			t.Errorf("%s %s: middlewares = %v, want %v", tt.method, tt.path, got, tt.wantMiddlewares)
+		}
+	}
+	if routes, _, err := router.Find("/shop/items"); err != nil || !slices.Equal(routes.Methods(), []http.Method{http.GET, http.POST}) {
+		t.Errorf("expected mounted route to keep all methods, got %v, %v", routes, err)
+	}
+	if _, _, err := router.Find("/shop/later"); err == nil {
+		t.Errorf("expected route added after mounting to be missing")
+	}
+
+	conflicting := server.NewRouter()
+	if err := conflicting.AddHandler("/:other", http.GET, noopHandler); err != nil {
+		t.Fatalf("failed adding handler: %v", err)
+	}
+	if err := router.Mount("/shop/items", conflicting); err == nil {
+		t.Errorf("expected error when mounting conflicting routes")
+	}
+
+	//mounting must not replace handlers that are already registered
+	duplicate := server.NewRouter()
+	for _, method := range []http.Method{http.DELETE, http.POST} {
+		if err := duplicate.AddHandler("/items", method, echo("duplicate")); err != nil {
+			t.Fatalf("failed adding handler: %v", err)
+		}
+	}
+	if err := router.Mount("/shop", duplicate); !errors.Is(err, server.ErrDuplicateRoute) {
+		t.Errorf("expected ErrDuplicateRoute when mounting an existing route, got %v", err)
+	}
+	if response := serve(t, router, http.POST, "/shop/items"); response.Body != "POST /items map[]" {
+		t.Errorf("expected mounting to keep the existing handler, got body %q", response.Body)
+	}
+	if routes, _, _ := router.Find("/shop/items"); routes.GetRoute(http.DELETE) != nil {
+		t.Errorf("expected a failed mount to add no handlers")
+	}
+}
+
+func TestNamedRoutesAndURLFor(t *testing.T) {
+	router := server.NewRouter()
+	api := router.Group("/api/v1")
+	if err := api.AddNamedHandler("user", "/users/:id", http.GET, noopHandler); err != nil {
+		t.Fatalf("failed adding handler: %v", err)
+	}
+	//another method on the same route keeps its name
+	if err := api.AddNamedHandler("user", "/users/:id", http.DELETE, noopHandler); err != nil {
+		t.Fatalf("failed adding handler: %v", err)
+	}
+	if err := router.AddNamedHandler("user", "/people/:id", http.GET, noopHandler); !errors.Is(err, server.ErrDuplicateRouteName) {
+		t.Errorf("expected ErrDuplicateRouteName, got %v", err)
+	}
+
+	files := server.NewRouter()
+	if err := files.AddNamedHandler("file", "/files/:owner/*path", http.GET, noopHandler); err != nil {
+		t.Fatalf("failed adding handler: %v", err)
+	}
+	if err := router.Mount("/storage", files); err != nil {
+		t.Fatalf("failed mounting router: %v", err)
+	}
+	//names are kept when mounting, so a router with named routes can only be mounted once
+	if err := router.Mount("/backup", files); !errors.Is(err, server.ErrDuplicateRouteName) {
+		t.Errorf("expected ErrDuplicateRouteName when mounting named routes twice, got %v", err)
+	}
+	if _, _, err := router.Find("/backup/files/me/docs"); err == nil {
+		t.Errorf("expected a failed mount to add no routes")
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    string
+		wantErr error
+	}{
+		{"user", map[string]string{"id": "42"}, "/api/v1/users/42", nil},
+		{"user", map[string]string{"id": "a b?#"}, "/api/v1/users/a%20b%3F%23", nil},
+		{"file", map[string]string{"owner": "me", "path": "docs/my file.txt"}, "/storage/files/me/docs/my%20file.txt", nil},
+		{"file", map[string]string{"owner": "me", "path": ""}, "/storage/files/me/", nil},
+		{"user", nil, "", server.ErrMissingRouteParam},
+		{"file", map[string]string{"owner": "me"}, "", server.ErrMissingRouteParam},
+		{"missing", nil, "", server.ErrUnknownRouteName},
+	}
+	for _, tt := range tests {
+		got, err := router.URLFor(tt.name, tt.params)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("URLFor(%s, %v) = %q, %v, want %q, %v", tt.name, tt.params, got, err, tt.want, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		//the built path must lead back to the route with the same parameters
+		u, err := http.ParseRequestTarget(got)
+		if err != nil {
+			t.Errorf("URLFor(%s) built unparsable path %q: %v", tt.name, got, err)
+			continue
+		}
+		_, params, err := router.Find(u.Path)
+		if err != nil {
+			t.Errorf("path %q built for %s doesn't match any route: %v", got, tt.name, err)
+		}
+		for key, value := range tt.params {
+			if params[key] != value {
+				t.Errorf("path %q built for %s matched %s=%q, want %q", got, tt.name, key, params[key], value)
+			}
+		}
+	}
+
+	//slashes in variables are escaped, even though the server rejects paths with encoded slashes
+	if got, _ := router.URLFor("user", map[string]string{"id": "a/b"}); got != "/api/v1/users/a%2Fb" {
+		t.Errorf("URLFor(user, a/b) = %q, want %q", got, "/api/v1/users/a%2Fb")
+	}
+
+	if err := router.RemoveRoute("/api/v1/users/:id"); err != nil {
+		t.Fatalf("failed removing route: %v", err)
+	}
+	if _, err := router.URLFor("user", map[string]string{"id": "42"}); !errors.Is(err, server.ErrUnknownRouteName) {
+		t.Errorf("expected the name of a removed route to be gone, got %v", err)
+	}
+}
+
+func TestRoutesListing(t *testing.T) {
+	dir := t.TempDir()
+	httpServer := server.NewHttpServer(0)
+	if err := httpServer.AddStaticRoutes("/static", dir); err != nil {
+		t.Fatalf("failed adding static routes: %v", err)
+	}
+	if err := httpServer.Group("/api", taggingMiddleware("api")).AddNamedHandler("user", "/users/:id", http.GET, noopHandler); err != nil {
+		t.Fatalf("failed adding handler: %v", err)
+	}
+	if err := httpServer.AddHandler("/api/users/:id", http.DELETE, handlers.HandlerFunc(handlers.NotFoundHandler)); err != nil {
+		t.Fatalf("failed adding handler: %v", err)
+	}
+	if err := httpServer.AddRoutesHandler("/debug/routes"); err != nil {
+		t.Fatalf("failed adding routes handler: %v", err)
+	}
+
+	routes := httpServer.Routes()
+	patterns := make([]string, len(routes))
+	for i, route := range routes {
+		patterns[i] = route.Pattern
+	}
+	wantPatterns := []string{"/api/users/:id", "/debug/routes", "/static", "/static/*filepath"}
+	if !slices.Equal(patterns, wantPatterns) {
+		t.Fatalf("Routes() patterns = %v, want %v", patterns, wantPatterns)
+	}
+
+	user := routes[slices.Index(patterns, "/api/users/:id")]
+	if !slices.Equal(user.Methods, []http.Method{http.GET, http.DELETE}) || !slices.Equal(user.Names, []string{"user"}) {
+		t.Errorf("unexpected methods %v or names %v of /api/users/:id", user.Methods, user.Names)
+	}
+	//middlewares don't hide the handler they wrap
+	if !strings.HasSuffix(user.Handlers[http.GET], "server_test.init.func1") {
+		t.Errorf("GET /api/users/:id described as %q", user.Handlers[http.GET])
+	}
+	if user.Handlers[http.DELETE] != "gophttp/handlers.NotFoundHandler" {
+		t.Errorf("DELETE /api/users/:id described as %q", user.Handlers[http.DELETE])
+	}
+	static := routes[slices.Index(patterns, "/static/*filepath")]
+	if want := "static directory " + dir; static.Handlers[http.GET] != want {
+		t.Errorf("static route described as %q, want %q", static.Handlers[http.GET], want)
+	}
+
+	text := serve(t, httpServer.Router(), http.GET, "/debug/routes")
+	body, _ := text.Body.(string)
+	if !strings.HasPrefix(body, "PATTERN") || !strings.Contains(body, "/api/users/:id") || !strings.Contains(body, "DELETE") {
+		t.Errorf("unexpected text listing:\n%s", body)
+	}
+
+	listing := serve(t, httpServer.Router(), http.GET, "/debug/routes?format=json")
+	if listing.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("expected JSON listing, got Content-Type %q", listing.Headers.Get("Content-Type"))
+	}
+	var decoded []struct {
+		Pattern  string            `json:"pattern"`
+		Names    []string          `json:"names"`
+		Methods  []string          `json:"methods"`
+		Handlers map[string]string `json:"handlers"`
+	}
+	if err := json.Unmarshal(listing.Body.([]byte), &decoded); err != nil {
+		t.Fatalf("failed decoding JSON listing: %v", err)
+	}
+	if len(decoded) != len(routes) || decoded[0].Pattern != routes[0].Pattern {
+		t.Fatalf("JSON listing %+v doesn't match Routes()", decoded)
+	}
+	for _, route := range decoded {
+		if route.Pattern == "/api/users/:id" && (!slices.Equal(route.Methods, []string{"GET", "DELETE"}) ||
+			route.Handlers["DELETE"] != "gophttp/handlers.NotFoundHandler" || !slices.Equal(route.Names, []string{"user"})) {
+			t.Errorf("unexpected JSON entry %+v", route)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"gophttp/handlers"
+	"gophttp/http"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Pattern string
+	// Names are the names given to the route, see Router.AddNamedHandler
+	Names   []string
+	Methods []http.Method
+	// Handlers describes the handler registered for each method, see handlers.Describe
+	Handlers map[http.Method]string
+}
+
+// Routes returns every route of r, sorted by pattern
+func (r *Router) Routes() []RouteInfo {
+	table := r.routes.Load()
+	names := make(map[string][]string)
+	for name, pattern := range table.names {
+		names[pattern] = append(names[pattern], name)
+	}
+
+	var routes []RouteInfo
+	for pattern, collection := range table.tree.Walk() {
+		info := RouteInfo{
+			Pattern:  pattern,
+			Names:    slices.Sorted(slices.Values(names[pattern])),
+			Methods:  collection.Methods(),
+			Handlers: make(map[http.Method]string),
+		}
+		for _, method := range info.Methods {
+			info.Handlers[method] = handlers.Describe(collection.GetRoute(method))
+		}
+		routes = append(routes, info)
+	}
+	slices.SortFunc(routes, func(a, b RouteInfo) int {
+		return strings.Compare(a.Pattern, b.Pattern)
+	})
+	return routes
+}
+
+// Routes returns every route of the server, sorted by pattern
+func (s *HttpServer) Routes() []RouteInfo {
+	return s.Router().Routes()
+}
+
+// AddRoutesHandler registers a GET handler on route listing the routes of the server, as JSON if the request asks
+// for application/json (via the Accept header or ?format=json) and as a plain text table otherwise.
+// The listing reveals the structure of the application, so only expose it where that is acceptable.
+func (s *HttpServer) AddRoutesHandler(route string) error {
+	return s.AddHandler(route, http.GET, handlers.HandlerFunc(func(ctx http.Context) error {
+		return writeRoutes(ctx, s.Routes())
+	}))
+}
+
+type routeJSON struct {
+	Pattern  string            `json:"pattern"`
+	Names    []string          `json:"names,omitempty"`
+	Methods  []string          `json:"methods"`
+	Handlers map[string]string `json:"handlers"`
+}
+
+func writeRoutes(ctx http.Context, routes []RouteInfo) error {
+	wantsJSON := ctx.Request.URL.Query.Get("format") == "json" ||
+		strings.Contains(ctx.Request.Headers.Get("Accept"), "application/json")
+	if wantsJSON {
+		listing := make([]routeJSON, len(routes))
+		for i, route := range routes {
+			listing[i] = routeJSON{Pattern: route.Pattern, Names: route.Names, Handlers: make(map[string]string)}
+			for _, method := range route.Methods {
+				listing[i].Methods = append(listing[i].Methods, method.String())
+				listing[i].Handlers[method.String()] = route.Handlers[method]
+			}
+		}
+		body, err := json.Marshal(listing)
+		if err != nil {
+			return err
+		}
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = body
+		ctx.Response.AddHeader(http.Header{Name: "Content-Type", Value: "application/json"})
+		return nil
+	}
+
+	var body strings.Builder
+	w := tabwriter.NewWriter(&body, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PATTERN\tMETHOD\tHANDLER\tNAMES")
+	for _, route := range routes {
+		for _, method := range route.Methods {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", route.Pattern, method, route.Handlers[method], strings.Join(route.Names, ", "))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	ctx.Response.Status = http.StatusOK
+	ctx.Response.Body = body.String()
+	ctx.Response.AddHeader(http.Header{Name: "Content-Type", Value: "text/plain"})
+	return nil
+}
@@ -11,28 +11,31 @@ import (
 	"log/slog"
 	"math"
 	"net"
-	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 type HttpServer struct {
-	routes     *common.RadixTree[RouteHandlerCollection]
-	port       int
-	reqIndex   uint64
-	muReqIndex sync.Mutex
+	router        atomic.Pointer[Router]
+	port          int
+	reqIndex      uint64
+	muReqIndex    sync.Mutex
+	requestLimits http.RequestLimits
+	middlewares   []handlers.Middleware
+	cors          *handlers.CORSHandler
 }
 
-var compressionHandler = handlers.NewCompressionHandler()
-
 func NewHttpServer(port int) *HttpServer {
-	return &HttpServer{
-		routes:   common.NewRadixTree[RouteHandlerCollection](),
-		port:     port,
-		reqIndex: math.MaxUint64,
+	s := &HttpServer{
+		port:          port,
+		reqIndex:      math.MaxUint64,
+		requestLimits: http.DefaultRequestLimits,
 	}
+	s.router.Store(NewRouter())
+	return s
 }
 
 func (s *HttpServer) nextReqIndex() uint64 {
@@ -42,74 +45,103 @@ func (s *HttpServer) nextReqIndex() uint64 {
 	return s.reqIndex
 }
 
+// Router returns the router currently used by the server
+func (s *HttpServer) Router() *Router {
+	return s.router.Load()
+}
+
+// SwapRouter atomically replaces the whole route table of the server with router and returns the previous one.
+// Requests that already looked up their handler finish with it, all following requests use the new router.
+func (s *HttpServer) SwapRouter(router *Router) *Router {
+	return s.router.Swap(router)
+}
+
+// SetRequestLimits configures how large request lines and headers may become, it must be called before StartServing
+func (s *HttpServer) SetRequestLimits(limits http.RequestLimits) {
+	s.requestLimits = limits
+}
+
+// Use adds middlewares to the server-wide middleware stack, which wraps the handling of every request, including
+// requests that end up with a 404 or 405. Middlewares run in the order they were added. It must be called before
+// StartServing. Use Router.With for middlewares that should only apply to some routes.
+func (s *HttpServer) Use(middlewares ...handlers.Middleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// EnableCORS answers CORS preflight requests and adds CORS headers to the responses of all routes, it must be called
+// before StartServing. Requests to paths without a route are answered with 404 Not Found as usual, preflight requests
+// included. Use the handlers.CORS middleware with Router.With to enable CORS on some routes only.
+func (s *HttpServer) EnableCORS(options handlers.CORSOptions) {
+	s.cors = handlers.NewCORSHandler(options)
+}
+
+// With returns a route group registering handlers wrapped into middlewares, see Router.With
+func (s *HttpServer) With(middlewares ...handlers.Middleware) *RouteGroup {
+	return s.Router().With(middlewares...)
+}
+
+// Group returns a route group registering its routes relative to prefix, see Router.Group
+func (s *HttpServer) Group(prefix string, middlewares ...handlers.Middleware) *RouteGroup {
+	return s.Router().Group(prefix, middlewares...)
+}
+
+// Mount adds all routes of sub to the server below prefix, see Router.Mount
+func (s *HttpServer) Mount(prefix string, sub *Router) error {
+	return s.Router().Mount(prefix, sub)
+}
+
 // AddFileRoutes searches for all files and directories under path and adds a handler for each of them to the server
 func (s *HttpServer) AddFileRoutes(path string) error {
-	files, err := common.ListFilesRecursive(path)
-	if err != nil {
-		panic(err)
-	}
-	dirs, err := common.ListDirsRecursive(path)
-	if err != nil {
-		panic(err)
-	}
+	return s.Router().AddFileRoutes(path)
+}
 
-	for _, file := range files {
-		joined := filepath.Join(path, file)
-		err = s.addFileRoute(joined)
-		if err != nil {
-			return err
-		}
-	}
+// AddFileRoutesWithOptions adds file routes compressed according to options, see Router.AddFileRoutesWithOptions
+func (s *HttpServer) AddFileRoutesWithOptions(path string, options handlers.CompressionOptions) error {
+	return s.Router().AddFileRoutesWithOptions(path, options)
+}
 
-	for _, dir := range dirs {
-		joined := filepath.Join(path, dir)
-		err = s.addDirRoute(joined)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+// AddStaticRoutes serves all files and directories under dir below the route prefix, see Router.AddStaticRoutes
+func (s *HttpServer) AddStaticRoutes(prefix string, dir string) error {
+	return s.Router().AddStaticRoutes(prefix, dir)
 }
 
-func (s *HttpServer) insertRoute(route string, method http.Method, handler handlers.Handler) error {
-	n, err := s.routes.Find(route)
-	if err != nil {
-		if errors.Is(err, common.ErrNoMatch) {
-			n = NewRouteHandlers()
-		} else {
-			return err
-		}
-	}
-	n.InsertRoute(method, handler)
-	err = s.routes.Insert(route, n)
-	return err
+// AddStaticRoutesWithOptions adds static routes compressed according to options, see Router.AddStaticRoutesWithOptions
+func (s *HttpServer) AddStaticRoutesWithOptions(prefix string, dir string, options handlers.CompressionOptions) error {
+	return s.Router().AddStaticRoutesWithOptions(prefix, dir, options)
 }
 
-func (s *HttpServer) addFileRoute(file string) error {
-	path := http.GetHttpPathForFilepath(file)
-	fh := handlers.NewFileHandler(file)
-	h := handlers.ComposeHandlers(fh, compressionHandler)
-	err := s.insertRoute(path, http.GET, h)
-	return err
+// AddHandler registers handler for requests with the given method on route, see Router.AddHandler
+func (s *HttpServer) AddHandler(route string, method http.Method, handler handlers.Handler) error {
+	return s.Router().AddHandler(route, method, handler)
 }
 
-func (s *HttpServer) addDirRoute(dir string) error {
-	path := http.GetHttpPathForFilepath(dir)
-	handler, err := handlers.NewDirectoryHandler(dir)
-	if err != nil {
-		return err
-	}
-	err = s.insertRoute(path, http.GET, handler)
-	return err
+// AddNamedHandler registers handler for requests with the given method on route and names the route, see
+// Router.AddNamedHandler
+func (s *HttpServer) AddNamedHandler(name string, route string, method http.Method, handler handlers.Handler) error {
+	return s.Router().AddNamedHandler(name, route, method, handler)
 }
 
-func (s *HttpServer) AddHandler(route string, method http.Method, handler handlers.Handler) error {
-	if route == "" {
-		return fmt.Errorf("invalid route: can't be empty string")
-	}
-	return s.insertRoute(route, method, handler)
+// URLFor builds the percent-encoded path of the route called name from params, see Router.URLFor
+func (s *HttpServer) URLFor(name string, params map[string]string) (string, error) {
+	return s.Router().URLFor(name, params)
+}
+
+// RemoveHandler removes the handler for method from route. If route has no handlers left, it is removed entirely.
+func (s *HttpServer) RemoveHandler(route string, method http.Method) error {
+	return s.Router().RemoveHandler(route, method)
+}
+
+// RemoveRoute removes route and all of its handlers from the server
+func (s *HttpServer) RemoveRoute(route string) error {
+	return s.Router().RemoveRoute(route)
 }
 
+// serverMethods is the Allow header of the response to OPTIONS *, listing every method handlers can be registered for
+var serverMethods = strings.Join([]string{
+	http.GET.String(), http.HEAD.String(), http.POST.String(), http.PUT.String(), http.DELETE.String(),
+	http.CONNECT.String(), http.OPTIONS.String(), http.TRACE.String(), http.PATCH.String(),
+}, ", ")
+
 func (s *HttpServer) StartServing(ctx context.Context) error {
 	sock, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
 	tcpSock := sock.(*net.TCPListener)
@@ -164,67 +196,62 @@ func (s *HttpServer) handleConnection(conn net.Conn) {
 		}
 	}(conn)
 
-	//open only ONE reader per connection, ever, as we need to be able to check here
-	//whether we should continue reading (i.e. there is another request)
-
-	//wrap connection in a buffered scanner
+	//open only ONE reader per connection, ever, as requests and their bodies are read from it one after another
 	r := bufio.NewReader(conn)
-	scan := bufio.NewScanner(r)
 
-	lastReqTS := time.Now()
 	//handle keep-alive: only exit this loop whenever we get Connection: close, error out, time out or HTTP/1.0
 	for {
-		if scan.Scan() {
-			lastReqTS = time.Now()
-			shouldClose := s.handleTCPMessage(conn, r, scan)
-			if shouldClose {
-				break
-			}
-		} else {
-			//TODO: make timeout configurable
-			timeout := 10 * time.Second
-			//wait 100ms, try again, if timeout: break
-			if time.Now().After(lastReqTS.Add(timeout)) {
-				//timed out, close connection
-				break
-			}
+		//TODO: make timeout configurable
+		timeout := 10 * time.Second
+		err := conn.SetReadDeadline(time.Now().Add(timeout))
+		if err != nil {
+			slog.Error("error setting connection deadline", "err", err.Error())
+			break
+		}
+		//block until the next request arrives, the client closes the connection or we time out
+		if _, err := r.Peek(1); err != nil {
+			break
+		}
+		shouldClose := s.handleTCPMessage(conn, r)
+		if shouldClose {
+			break
 		}
 	}
 }
 
-func (s *HttpServer) handleTCPMessage(conn net.Conn, r *bufio.Reader, scan *bufio.Scanner) bool {
+func (s *HttpServer) handleTCPMessage(conn net.Conn, r *bufio.Reader) bool {
 	idx := s.nextReqIndex()
 	//create an HTTP context with an empty response for the connection
 	ctx := http.NewContext(conn, idx)
 
 	//parse the request
 	var err error
-	ctx.Request, err = http.ParseRequest(ctx, r, scan)
+	ctx.Request, err = http.ParseRequestWithLimits(ctx, r, s.requestLimits)
 	//queue writing response to connection (we must always answer with at least something, no matter how hard we error out)
-	defer writeResponseToConn(ctx, 0)
-
-	//add common headers required on every response
+	//unless the handler already streamed its response through ctx.Writer
 	defer func(ctx http.Context) {
+		if !ctx.Writer.Started() {
+			writeResponseToConn(ctx, 0)
+		}
+	}(ctx)
+
+	//streamed responses get the headers required on every response right before their headers are written,
+	//all others get them from the handlers.ResponseHeaders middleware
+	ctx.Writer.OnWriteHeader(func() {
 		err := handlers.ResponseHeadersHandler(ctx)
 		if err != nil {
 			//handle gracefully? should never error out though
 			panic(err)
 		}
-	}(ctx)
+	})
 	if err != nil {
-		if errors.Is(err, http.ErrInvalidRequest) ||
-			errors.Is(err, http.ErrInvalidHttpMethod) ||
-			errors.Is(err, http.ErrInvalidHttpVersion) {
-			slog.Debug("request failed parsing", "err", err, "index", ctx.Index)
-			err := handlers.BadRequestHandler(ctx)
-			//bad request handler may never error out
-			if err != nil {
-				//we messed up big time if we ever get here, error handlers must be error free
-				panic(err)
-			}
-			return true
+		err := handlers.ResponseHeaders(parseErrorHandler(ctx, err)).HandleRequest(ctx)
+		//error handlers may never error out
+		if err != nil {
+			//we messed up big time if we ever get here, error handlers must be error free
+			panic(err)
 		}
-		panic(err)
+		return true
 	}
 	//print the request for debugging
 	ra := slog.Group("request",
@@ -234,40 +261,149 @@ func (s *HttpServer) handleTCPMessage(conn net.Conn, r *bufio.Reader, scan *bufi
 		"headers", ctx.Request.Headers)
 	slog.Debug(ra.String(), "index", ctx.Index)
 
-	routes, err := s.routes.Find(ctx.Request.Path)
-	if err != nil {
-		if errors.Is(err, common.ErrNoMatch) {
-			//this handler never errors
-			_ = handlers.NotFoundHandler(ctx)
+	//responses to HEAD never have a body, not even error responses
+	if ctx.Request.Method == http.HEAD {
+		ctx.Response.OmitBody = true
+	}
+
+	//the common headers are added last, so they see the final body, errors are turned into responses before that
+	middlewares := append([]handlers.Middleware{handlers.ResponseHeaders, handleErrors}, s.middlewares...)
+	err = handlers.Chain(handlers.HandlerFunc(s.route), middlewares...).HandleRequest(ctx)
+	if ctx.Writer.Started() {
+		//the response is already on its way, all we can do on errors is to abort it by closing the connection
+		if err != nil {
+			slog.Error("error in handler after response was started", "err", err, "index", ctx.Index)
+			//send what we have, the missing end of the body tells the client the response is incomplete
+			_ = ctx.Writer.Flush()
 			return true
-		} else {
-			err := fmt.Errorf("error fetching handler from radix tree: %w", err)
-			if err != nil {
-				panic(err)
-			}
-			_ = handlers.InternalServerErrorHandler(ctx)
+		}
+		err = ctx.Writer.Close()
+		if err != nil {
+			slog.Debug("failed finishing streamed response", "err", err, "index", ctx.Index)
 			return true
 		}
+	} else if err != nil {
+		panic(err)
+	}
+
+	return finishRequest(ctx)
+}
+
+// parseErrorHandler returns the handler answering a request that failed parsing with err
+func parseErrorHandler(ctx http.Context, err error) handlers.Handler {
+	switch {
+	case errors.Is(err, http.ErrURITooLong):
+		slog.Debug("request line too long", "err", err, "index", ctx.Index)
+		return handlers.HandlerFunc(handlers.URITooLongHandler)
+	case errors.Is(err, http.ErrRequestHeaderFieldsTooLarge):
+		slog.Debug("request headers too large", "err", err, "index", ctx.Index)
+		return handlers.HandlerFunc(handlers.RequestHeaderFieldsTooLargeHandler)
+	case errors.Is(err, http.ErrInvalidRequest),
+		errors.Is(err, http.ErrInvalidHttpMethod),
+		errors.Is(err, http.ErrInvalidHttpVersion):
+		slog.Debug("request failed parsing", "err", err, "index", ctx.Index)
+		return handlers.HandlerFunc(handlers.BadRequestHandler)
+	case errors.Is(err, http.ErrUnsupportedContentEncoding):
+		slog.Debug("request has unsupported content encoding", "err", err, "index", ctx.Index)
+		return handlers.HandlerFunc(handlers.UnsupportedMediaTypeHandler)
+	case errors.Is(err, http.ErrUnsupportedTransferEncoding):
+		slog.Debug("request has unsupported transfer encoding", "err", err, "index", ctx.Index)
+		return handlers.HandlerFunc(handlers.NotImplementedHandler)
+	default:
+		panic(err)
+	}
+}
+
+// handleErrors turns errors returned by next into error responses. Errors of streamed responses are passed on, as
+// their status was sent already.
+func handleErrors(next handlers.Handler) handlers.Handler {
+	return handlers.HandlerFunc(func(ctx http.Context) error {
+		err := next.HandleRequest(ctx)
+		if err == nil || ctx.Writer.Started() {
+			return err
+		}
+		if errors.Is(err, http.ErrInvalidRequest) {
+			//the handler failed reading a malformed body, we can't know where the next request starts
+			slog.Debug("request body failed parsing", "err", err, "index", ctx.Index)
+			ctx.AdditionalData["BadRequestReason"] = "Failed parsing request body"
+			return handlers.BadRequestHandler(ctx)
+		}
+		if errors.Is(err, http.ErrBodyTooLarge) {
+			slog.Debug("request body too large", "err", err, "index", ctx.Index)
+			return handlers.PayloadTooLargeHandler(ctx)
+		}
+		slog.Error("error in handler", "err", err, "index", ctx.Index)
+		return handlers.InternalServerErrorHandler(ctx)
+	})
+}
+
+// route finds the handler registered for the request and runs it, answering requests without a matching handler
+// with 404 or 405 and OPTIONS requests without an OPTIONS handler with the methods of the route
+func (s *HttpServer) route(ctx http.Context) error {
+	//the asterisk-form only exists to ask the server itself which methods it supports
+	if ctx.Request.Path == "*" {
+		if ctx.Request.Method != http.OPTIONS {
+			ctx.AdditionalData["BadRequestReason"] = "Request target * is only allowed for OPTIONS"
+			return handlers.BadRequestHandler(ctx)
+		}
+		ctx.Response.AddHeader(http.Header{Name: "Allow", Value: serverMethods})
+		return handlers.OptionsHandler(ctx)
+	}
+
+	routes, params, err := s.Router().Find(ctx.Request.Path)
+	if err != nil {
+		if errors.Is(err, common.ErrNoMatch) {
+			return handlers.NotFoundHandler(ctx)
+		}
+		return fmt.Errorf("error fetching handler from radix tree: %w", err)
+	}
+	if s.cors != nil {
+		//preflight requests are answered for every route, no matter whether it has an OPTIONS handler
+		_ = s.cors.HandleRequest(ctx)
+		if handlers.IsPreflightRequest(ctx.Request) {
+			return nil
+		}
 	}
 	//try to find handler for HTTP method
 	handler := routes.GetRoute(ctx.Request.Method)
+	//HEAD is answered with the headers GET would produce, so unless a route has its own HEAD handler, the GET
+	//handler runs and only its body is dropped when writing the response
+	if handler == nil && ctx.Request.Method == http.HEAD {
+		handler = routes.GetRoute(http.GET)
+	}
+	//unless a route has its own OPTIONS handler, the server answers with the methods of the route
+	if handler == nil && ctx.Request.Method == http.OPTIONS {
+		ctx.Response.AddHeader(http.Header{Name: "Allow", Value: allowedMethods(routes)})
+		handler = handlers.HandlerFunc(handlers.OptionsHandler)
+	}
 	if handler == nil {
-		_ = handlers.NotFoundHandler(ctx)
+		ctx.Response.AddHeader(http.Header{Name: "Allow", Value: allowedMethods(routes)})
+		return handlers.MethodNotAllowedHandler(ctx)
+	}
+	ctx.Params = params
+	return handler.HandleRequest(ctx)
+}
+
+// finishRequest prepares the connection for the next request once the response to ctx.Request was prepared and reports
+// whether the connection has to be closed instead
+func finishRequest(ctx http.Context) bool {
+	//error responses ask for the connection to be closed, e.g. because we don't know where the next request starts
+	if ctx.Request.Close || ctx.Response.Headers.ContainsToken("Connection", "close") {
 		return true
 	}
-	err = handler.HandleRequest(ctx)
+	//discard whatever the handler didn't read of the body, so the next request is read from the right position
+	err := ctx.Request.Body.Close()
 	if err != nil {
-		slog.Error("error in handler", "handler", handler, "err", err, "index", ctx.Index)
-		_ = handlers.InternalServerErrorHandler(ctx)
+		slog.Debug("failed draining request body, closing connection", "err", err, "index", ctx.Index)
+		ctx.Response.AddHeader(http.Header{Name: "Connection", Value: "close"})
+		return true
 	}
 
 	switch ctx.Request.Version {
 	case http.HTTP1_0:
-		h, ok := ctx.Request.Headers["Connection"]
-		return !(ok && strings.TrimSpace(h.Value) == "keep-alive")
+		return !ctx.Request.Headers.ContainsToken("Connection", "keep-alive")
 	case http.HTTP1_1:
-		h, ok := ctx.Request.Headers["Connection"]
-		return ok && strings.TrimSpace(h.Value) == "close"
+		return ctx.Request.Headers.ContainsToken("Connection", "close")
 	default:
 		panic("unsupported http version")
 	}
@@ -5,15 +5,23 @@ package server_test
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"net/http/httputil"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/andybalholm/brotli"
+
 	"gophttp/handlers"
 	"gophttp/http"
 	"gophttp/server"
@@ -244,7 +252,7 @@ func TestStreamedResponseWithDelayAndBrotliAccept(t *testing.T) {
 
 	reader := bufio.NewReader(conn)
 	//brotli buffers all segments before compressing, meaning we only get one big compressed chunk
-	body1 := make([]byte, 203)
+	body1 := make([]byte, 219)
 	_, err = reader.Read(body1)
 	if err != nil {
 		t.Fatalf("failed to read first segment: %v", err)
@@ -260,9 +268,10 @@ func TestStreamedResponseWithDelayAndBrotliAccept(t *testing.T) {
 		0x37, 0x3a, 0x35, 0x30, 0x20, 0x47, 0x4d, 0x54, 0x0a, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x3a,
 		0x20, 0x67, 0x6f, 0x70, 0x68, 0x74, 0x74, 0x70, 0x2f, 0x30, 0x2e, 0x31, 0x0a, 0x54, 0x72, 0x61,
 		0x6e, 0x73, 0x66, 0x65, 0x72, 0x2d, 0x45, 0x6e, 0x63, 0x6f, 0x64, 0x69, 0x6e, 0x67, 0x3a, 0x20,
-		0x63, 0x68, 0x75, 0x6e, 0x6b, 0x65, 0x64, 0x0a, 0x0a, 0x31, 0x31, 0x0d, 0x0a, 0x1b, 0x01, 0x02,
-		0x00, 0x24, 0x15, 0x8c, 0x98, 0x6a, 0xb1, 0xcd, 0x0a, 0x40, 0xe4, 0x3e, 0x47, 0x00, 0x0d, 0x0a,
-		0x30, 0x0d, 0x0a, 0x0d, 0x0a,
+		0x63, 0x68, 0x75, 0x6e, 0x6b, 0x65, 0x64, 0x0a, 0x56, 0x61, 0x72, 0x79, 0x3a, 0x20, 0x41, 0x63,
+		0x63, 0x65, 0x70, 0x74, 0x2d, 0x45, 0x6e, 0x63, 0x6f, 0x64, 0x69, 0x6e, 0x67, 0x0a, 0x0a, 0x31,
+		0x31, 0x0d, 0x0a, 0x1b, 0x01, 0x02, 0x00, 0x24, 0x15, 0x8c, 0x98, 0x6a, 0xb1, 0xcd, 0x0a, 0x40,
+		0xe4, 0x3e, 0x47, 0x00, 0x0d, 0x0a, 0x30, 0x0d, 0x0a, 0x0d, 0x0a,
 	}
 
 	if len(body1) < len(expectedBytes) {
@@ -420,3 +429,1188 @@ func TestAddFileRoutesWithAbsolutePath(t *testing.T) {
 	cancel()
 	_ = <-servClosed
 }
+
+// startTestServer starts httpServer in the background and returns a function that stops it and waits until it is closed
+func startTestServer(t *testing.T, httpServer *server.HttpServer) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	servClosed := make(chan bool, 1)
+	go func() {
+		defer func() { servClosed <- true }()
+		if err := httpServer.StartServing(ctx); err != nil {
+			t.Errorf("failed to serve: %v", err)
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	return func() {
+		cancel()
+		_ = <-servClosed
+	}
+}
+
+// sendRawRequest writes req to a new connection to the server on port and returns everything the server answered
+// until it closed the connection
+func sendRawRequest(t *testing.T, port int, req string) string {
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var response bytes.Buffer
+	_, _ = response.ReadFrom(conn)
+	return response.String()
+}
+
+func TestRouteWithPathParameters(t *testing.T) {
+	port := 8094
+	httpServer := server.NewHttpServer(port)
+
+	err := httpServer.AddHandler("/users/:id/posts/:postId", http.GET, handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = fmt.Sprintf("user=%s post=%s", ctx.Param("id"), ctx.Param("postId"))
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	err = httpServer.AddHandler("/users/:name/posts/:postId", http.POST, handlers.HandlerFunc(func(ctx http.Context) error {
+		return nil
+	}))
+	if err == nil {
+		t.Errorf("expected error when registering conflicting route")
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	response := sendRawRequest(t, port, "GET /users/42/posts/7 HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if !strings.Contains(response, "user=42 post=7") {
+		t.Errorf("expected path parameters in response, got: %q", response)
+	}
+}
+
+func TestAddStaticRoutesServesFilesCreatedLater(t *testing.T) {
+	port := 8095
+	httpServer := server.NewHttpServer(port)
+
+	tmpDir := t.TempDir()
+	if err := httpServer.AddStaticRoutes("/static", tmpDir); err != nil {
+		t.Fatalf("failed adding static routes: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	const fileContent = "created after startup"
+	err := os.MkdirAll(filepath.Join(tmpDir, "sub"), 0o755)
+	if err != nil {
+		t.Fatalf("failed creating temp dir: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(tmpDir, "sub", "late.txt"), []byte(fileContent), 0o644)
+	if err != nil {
+		t.Fatalf("failed creating temp file: %v", err)
+	}
+
+	response := sendRawRequest(t, port, "GET /static/sub/late.txt HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if !strings.Contains(response, fileContent) {
+		t.Errorf("expected file content in response, got: %q", response)
+	}
+	response = sendRawRequest(t, port, "GET /static/sub HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if !strings.Contains(response, `href="/static/sub/late.txt"`) {
+		t.Errorf("expected link to file in directory listing, got: %q", response)
+	}
+	response = sendRawRequest(t, port, "GET /static/../../etc/passwd HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if !strings.Contains(response, "404 Not Found") {
+		t.Errorf("expected 404 for path outside of static root, got: %q", response)
+	}
+}
+
+func TestRemoveHandlerAtRuntime(t *testing.T) {
+	port := 8096
+	httpServer := server.NewHttpServer(port)
+
+	const testPath = "/feature"
+	handler := handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = "feature enabled"
+		return nil
+	})
+	if err := httpServer.AddHandler(testPath, http.GET, handler); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	if err := httpServer.AddHandler(testPath, http.POST, handler); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n", testPath)
+	if response := sendRawRequest(t, port, req); !strings.Contains(response, "200 OK") {
+		t.Errorf("expected 200 before removing handler, got: %q", response)
+	}
+	if err := httpServer.RemoveHandler(testPath, http.GET); err != nil {
+		t.Fatalf("failed removing handler: %v", err)
+	}
+	if err := httpServer.RemoveHandler(testPath, http.GET); err == nil {
+		t.Errorf("expected error when removing handler twice")
+	}
+	if response := sendRawRequest(t, port, req); !strings.Contains(response, "405 Method Not Allowed") {
+		t.Errorf("expected 405 after removing handler, got: %q", response)
+	}
+	if err := httpServer.RemoveRoute(testPath); err != nil {
+		t.Fatalf("failed removing route: %v", err)
+	}
+	if response := sendRawRequest(t, port, req); !strings.Contains(response, "404 Not Found") {
+		t.Errorf("expected 404 after removing route, got: %q", response)
+	}
+	if err := httpServer.RemoveRoute(testPath); err == nil {
+		t.Errorf("expected error when removing route twice")
+	}
+}
+
+func TestRequestBodyIsStreamedAndDrained(t *testing.T) {
+	port := 8097
+	httpServer := server.NewHttpServer(port)
+
+	err := httpServer.AddHandler("/upload", http.POST, handlers.HandlerFunc(func(ctx http.Context) error {
+		n, err := io.Copy(io.Discard, ctx.Request.Body)
+		if err != nil {
+			return err
+		}
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = fmt.Sprintf("received %d bytes", n)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	err = httpServer.AddHandler("/ignore", http.POST, handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = "ignored body"
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	body := strings.Repeat("x", 1<<20)
+	req := fmt.Sprintf("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: %d\r\n\r\n%s", len(body), body) +
+		"POST /ignore HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello" +
+		"POST /ignore HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nContent-Length: 5\r\n\r\nhello"
+	response := sendRawRequest(t, port, req)
+	if !strings.Contains(response, fmt.Sprintf("received %d bytes", len(body))) {
+		t.Errorf("expected whole body to be received, got: %q", response)
+	}
+	if count := strings.Count(response, "ignored body"); count != 2 {
+		t.Errorf("expected 2 responses for requests with unread bodies, got %d in: %q", count, response)
+	}
+}
+
+func TestMalformedChunkedBodyIsBadRequest(t *testing.T) {
+	port := 8098
+	httpServer := server.NewHttpServer(port)
+
+	err := httpServer.AddHandler("/upload", http.POST, handlers.HandlerFunc(func(ctx http.Context) error {
+		b, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			return err
+		}
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = fmt.Sprintf("%s|%s", b, ctx.Request.Trailers.Get("checksum"))
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	response := sendRawRequest(t, port, "POST /upload HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n"+
+		"Transfer-Encoding: chunked\r\n\r\n7;ext=1\r\nhel\nlo!\r\n0\r\nChecksum: abc\r\n\r\n")
+	if !strings.Contains(response, "200 OK") || !strings.Contains(response, "hel\nlo!|abc") {
+		t.Errorf("expected decoded body and trailer in response, got: %q", response)
+	}
+	response = sendRawRequest(t, port, "POST /upload HTTP/1.1\r\nHost: localhost\r\n"+
+		"Transfer-Encoding: chunked\r\n\r\nzz\r\nhello\r\n0\r\n\r\n")
+	if !strings.Contains(response, "400 Bad Request") {
+		t.Errorf("expected 400 for malformed chunked body, got: %q", response)
+	}
+
+	//a request framed by both Transfer-Encoding and Content-Length is answered, but nothing pipelined after it
+	response = sendRawRequest(t, port, "POST /upload HTTP/1.1\r\nHost: localhost\r\n"+
+		"Transfer-Encoding: chunked\r\nContent-Length: 4\r\n\r\n5\r\nhello\r\n0\r\n\r\n"+
+		"POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 8\r\n\r\nsmuggled")
+	if !strings.Contains(response, "200 OK") || responseHeader(response, "Connection") != "close" {
+		t.Errorf("expected first request to be answered with Connection: close, got: %q", response)
+	}
+	if strings.Count(response, "HTTP/1.1 ") != 1 || strings.Contains(response, "smuggled") {
+		t.Errorf("expected pipelined request after ambiguous framing not to be answered, got: %q", response)
+	}
+
+	response = sendRawRequest(t, port, "POST /upload HTTP/1.1\r\nHost: localhost\r\n"+
+		"Transfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n")
+	if !strings.Contains(response, "501 Not Implemented") || responseHeader(response, "Connection") != "close" {
+		t.Errorf("expected 501 for unsupported transfer coding, got: %q", response)
+	}
+	response = sendRawRequest(t, port, "POST /upload HTTP/1.1\r\nHost: localhost\r\n"+
+		"Transfer-Encoding: chunked, gzip\r\n\r\n0\r\n\r\n")
+	if !strings.Contains(response, "400 Bad Request") {
+		t.Errorf("expected 400 for transfer coding not ending with chunked, got: %q", response)
+	}
+}
+
+func TestUnsupportedRequestContentEncoding(t *testing.T) {
+	port := 8099
+	httpServer := server.NewHttpServer(port)
+
+	err := httpServer.AddHandler("/upload", http.POST, handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	response := sendRawRequest(t, port, "POST /upload HTTP/1.1\r\nHost: localhost\r\n"+
+		"Content-Encoding: compress\r\nContent-Length: 5\r\n\r\nhello")
+	if !strings.Contains(response, "415 Unsupported Media Type") {
+		t.Errorf("expected 415 for unknown content encoding, got: %q", response)
+	}
+	if !strings.Contains(response, "Accept-Encoding: "+http.SupportedContentEncodings) {
+		t.Errorf("expected Accept-Encoding header listing supported encodings, got: %q", response)
+	}
+}
+
+func TestRouteMatchingUsesNormalizedPath(t *testing.T) {
+	port := 8100
+	httpServer := server.NewHttpServer(port)
+
+	err := httpServer.AddHandler("/search", http.GET, handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = fmt.Sprintf("q=%s tags=%v", ctx.Request.URL.Query.Get("q"), ctx.Request.URL.Query.Values("tag"))
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	response := sendRawRequest(t, port, "GET /a/../search?q=hello%20world&tag=x&tag=y HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if !strings.Contains(response, "q=hello world tags=[x y]") {
+		t.Errorf("expected query parameters in response, got: %q", response)
+	}
+	response = sendRawRequest(t, port, "GET /search%zz HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	if !strings.Contains(response, "400 Bad Request") {
+		t.Errorf("expected 400 for invalid percent-encoding, got: %q", response)
+	}
+	//encoded slashes must not turn into separators that route the request elsewhere
+	response = sendRawRequest(t, port, "GET /a%2F..%2Fsearch HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	if !strings.Contains(response, "400 Bad Request") {
+		t.Errorf("expected 400 for encoded slash, got: %q", response)
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	port := 8101
+	httpServer := server.NewHttpServer(port)
+	limits := http.DefaultRequestLimits
+	limits.MaxRequestLineLength = 128
+	limits.MaxHeaderCount = 2
+	httpServer.SetRequestLimits(limits)
+
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	response := sendRawRequest(t, port, "GET /"+strings.Repeat("a", 200)+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	if !strings.Contains(response, "414 URI Too Long") {
+		t.Errorf("expected 414 for long request line, got: %q", response)
+	}
+	response = sendRawRequest(t, port, "GET / HTTP/1.1\r\nHost: localhost\r\nA: 1\r\nB: 2\r\n\r\n")
+	if !strings.Contains(response, "431 Request Header Fields Too Large") {
+		t.Errorf("expected 431 for too many headers, got: %q", response)
+	}
+}
+
+// responseHeader returns the value of the header name in the raw response, or an empty string if it is missing
+func responseHeader(response string, name string) string {
+	head, _, _ := strings.Cut(response, "\n\n")
+	for _, line := range strings.Split(head, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(key, name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func TestConditionalGetOnFiles(t *testing.T) {
+	port := 8102
+	httpServer := server.NewHttpServer(port)
+
+	tmpDir := t.TempDir()
+	//large enough to be worth compressing
+	fileContent := strings.Repeat("cache me if you can. ", 20)
+	err := os.WriteFile(filepath.Join(tmpDir, "asset.txt"), []byte(fileContent), 0o644)
+	if err != nil {
+		t.Fatalf("failed creating temp file: %v", err)
+	}
+	if err := httpServer.AddStaticRoutes("/static", tmpDir); err != nil {
+		t.Fatalf("failed adding static routes: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	const request = "GET /static/asset.txt HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n%s\r\n"
+	response := sendRawRequest(t, port, fmt.Sprintf(request, ""))
+	etag := responseHeader(response, "ETag")
+	lastModified := responseHeader(response, "Last-Modified")
+	if !strings.HasPrefix(etag, `"`) || lastModified == "" {
+		t.Fatalf("expected strong ETag and Last-Modified, got: %q", response)
+	}
+
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "If-None-Match: "+etag+"\r\n"))
+	if !strings.Contains(response, "304 Not Modified") || strings.Contains(response, fileContent) {
+		t.Errorf("expected 304 without body for matching If-None-Match, got: %q", response)
+	}
+	if responseHeader(response, "ETag") != etag {
+		t.Errorf("expected 304 to repeat the ETag, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "If-Modified-Since: "+lastModified+"\r\n"))
+	if !strings.Contains(response, "304 Not Modified") {
+		t.Errorf("expected 304 for If-Modified-Since, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "If-Match: \"outdated\"\r\n"))
+	if !strings.Contains(response, "412 Precondition Failed") || responseHeader(response, "Content-Length") != "0" {
+		t.Errorf("expected empty 412 for failed If-Match, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "If-None-Match: \"outdated\"\r\n"))
+	if !strings.Contains(response, "200 OK") || !strings.Contains(response, fileContent) {
+		t.Errorf("expected full response for outdated ETag, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "Accept-Encoding: br\r\n"))
+	if responseHeader(response, "ETag") != "W/"+etag {
+		t.Errorf("expected weak ETag on compressed response, got: %q", response)
+	}
+}
+
+func TestRangeRequestsOnFiles(t *testing.T) {
+	port := 8103
+	httpServer := server.NewHttpServer(port)
+
+	tmpDir := t.TempDir()
+	const fileContent = "0123456789abcdefghij"
+	err := os.WriteFile(filepath.Join(tmpDir, "data.txt"), []byte(fileContent), 0o644)
+	if err != nil {
+		t.Fatalf("failed creating temp file: %v", err)
+	}
+	if err := httpServer.AddStaticRoutes("/static", tmpDir); err != nil {
+		t.Fatalf("failed adding static routes: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	const request = "GET /static/data.txt HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nAccept-Encoding: br\r\n%s\r\n"
+	response := sendRawRequest(t, port, fmt.Sprintf(request, "Range: bytes=2-5\r\n"))
+	if !strings.Contains(response, "206 Partial Content") || !strings.HasSuffix(response, "\n\n2345") {
+		t.Errorf("expected uncompressed partial content, got: %q", response)
+	}
+	if responseHeader(response, "Content-Range") != "bytes 2-5/20" || responseHeader(response, "Content-Encoding") != "" {
+		t.Errorf("expected Content-Range and no Content-Encoding, got: %q", response)
+	}
+
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "Range: bytes=0-1,-2\r\n"))
+	contentType := responseHeader(response, "Content-Type")
+	if !strings.Contains(response, "206 Partial Content") || !strings.HasPrefix(contentType, "multipart/byteranges; boundary=") {
+		t.Fatalf("expected multipart/byteranges response, got: %q", response)
+	}
+	if !strings.Contains(response, "Content-Range: bytes 0-1/20\r\n") || !strings.Contains(response, "\r\n\r\n01\r\n--") ||
+		!strings.Contains(response, "Content-Range: bytes 18-19/20\r\n") || !strings.Contains(response, "\r\n\r\nij\r\n--") {
+		t.Errorf("expected both ranges as parts, got: %q", response)
+	}
+
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "Range: bytes=50-\r\n"))
+	if !strings.Contains(response, "416 Range Not Satisfiable") || responseHeader(response, "Content-Range") != "bytes */20" {
+		t.Errorf("expected 416 with unsatisfied Content-Range, got: %q", response)
+	}
+
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "Range: bytes=2-5\r\nIf-Range: \"outdated\"\r\n"))
+	if !strings.Contains(response, "200 OK") || responseHeader(response, "Accept-Ranges") != "bytes" {
+		t.Errorf("expected full response for outdated If-Range, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "Range: bytes=5-2\r\n"))
+	if !strings.Contains(response, "200 OK") {
+		t.Errorf("expected malformed Range to be ignored, got: %q", response)
+	}
+}
+
+func TestLargeFileIsStreamed(t *testing.T) {
+	port := 8104
+	httpServer := server.NewHttpServer(port)
+
+	tmpDir := t.TempDir()
+	fileContent := bytes.Repeat([]byte("0123456789abcdef"), 512*1024)
+	err := os.WriteFile(filepath.Join(tmpDir, "large.bin"), fileContent, 0o644)
+	if err != nil {
+		t.Fatalf("failed creating temp file: %v", err)
+	}
+	if err := httpServer.AddStaticRoutes("/static", tmpDir); err != nil {
+		t.Fatalf("failed adding static routes: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	response := sendRawRequest(t, port, "GET /static/large.bin HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if responseHeader(response, "Content-Length") != fmt.Sprint(len(fileContent)) {
+		t.Errorf("expected Content-Length of the file, got headers: %q", response[:strings.Index(response, "\n\n")])
+	}
+	_, body, _ := strings.Cut(response, "\n\n")
+	if body != string(fileContent) {
+		t.Errorf("expected body to be the file content, got %d bytes", len(body))
+	}
+
+	//compressed files are compressed while they are sent, so their length isn't known up front
+	err = os.WriteFile(filepath.Join(tmpDir, "large.txt"), fileContent, 0o644)
+	if err != nil {
+		t.Fatalf("failed creating temp file: %v", err)
+	}
+	response = sendRawRequest(t, port, "GET /static/large.txt HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nAccept-Encoding: br\r\n\r\n")
+	if responseHeader(response, "Content-Encoding") != "br" || responseHeader(response, "Transfer-Encoding") != "chunked" ||
+		responseHeader(response, "Content-Length") != "" {
+		t.Fatalf("expected chunked brotli response, got headers: %q", response[:strings.Index(response, "\n\n")])
+	}
+	if decoded := decodeBody(t, response, "br"); !bytes.Equal(decoded, fileContent) {
+		t.Errorf("expected compressed body to decode to the file content, got %d bytes", len(decoded))
+	}
+}
+
+func TestReaderBodyOfUnknownLengthIsChunked(t *testing.T) {
+	port := 8105
+	httpServer := server.NewHttpServer(port)
+
+	err := httpServer.AddHandler("/report", http.GET, handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = io.MultiReader(strings.NewReader("first,"), strings.NewReader("second"))
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	err = httpServer.AddHandler("/sized", http.GET, handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = http.NewSizedReader(io.MultiReader(strings.NewReader("first,"), strings.NewReader("second")), 12)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	response := sendRawRequest(t, port, "GET /report HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if responseHeader(response, "Transfer-Encoding") != "chunked" || !strings.HasSuffix(response, "\n\n6\r\nfirst,\r\n6\r\nsecond\r\n0\r\n\r\n") {
+		t.Errorf("expected chunked body, got: %q", response)
+	}
+	response = sendRawRequest(t, port, "GET /sized HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if responseHeader(response, "Content-Length") != "12" || !strings.HasSuffix(response, "\n\nfirst,second") {
+		t.Errorf("expected body with Content-Length, got: %q", response)
+	}
+}
+
+func TestResponseWriterStreamsWhileHandlerRuns(t *testing.T) {
+	port := 8106
+	httpServer := server.NewHttpServer(port)
+
+	proceed := make(chan struct{})
+	err := httpServer.AddHandler("/report", http.GET, handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.AddHeader(http.Header{Name: "Content-Type", Value: "text/plain"})
+		_, err := ctx.Writer.Write([]byte("line 1\n"))
+		if err != nil {
+			return err
+		}
+		err = ctx.Writer.Flush()
+		if err != nil {
+			return err
+		}
+		//only continue once the client received the first line
+		<-proceed
+		_, err = ctx.Writer.Write([]byte("line 2\n"))
+		return err
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	err = httpServer.AddHandler("/broken", http.GET, handlers.HandlerFunc(func(ctx http.Context) error {
+		_, _ = ctx.Writer.Write([]byte("partial"))
+		return fmt.Errorf("report generation failed")
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Write([]byte("GET /report HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	var head strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed reading headers: %v (got %q)", err, head.String())
+		}
+		if line == "\n" {
+			break
+		}
+		head.WriteString(line)
+	}
+	if !strings.Contains(head.String(), "Transfer-Encoding: chunked") || !strings.Contains(head.String(), "Server: ") {
+		t.Errorf("expected chunked response with common headers, got: %q", head.String())
+	}
+	firstChunk := make([]byte, len("7\r\nline 1\n\r\n"))
+	_, err = io.ReadFull(reader, firstChunk)
+	if err != nil || string(firstChunk) != "7\r\nline 1\n\r\n" {
+		t.Fatalf("expected first chunk before handler finished, got %q, %v", firstChunk, err)
+	}
+	close(proceed)
+	rest := make([]byte, len("7\r\nline 2\n\r\n0\r\n\r\n"))
+	_, err = io.ReadFull(reader, rest)
+	if err != nil || string(rest) != "7\r\nline 2\n\r\n0\r\n\r\n" {
+		t.Errorf("expected second chunk and end of body, got %q, %v", rest, err)
+	}
+
+	response := sendRawRequest(t, port, "GET /broken HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	if !strings.Contains(response, "200 OK") || strings.HasSuffix(response, "0\r\n\r\n") {
+		t.Errorf("expected aborted response without terminating chunk, got: %q", response)
+	}
+}
+
+func TestHeadRequestsUseGetHandlers(t *testing.T) {
+	port := 8107
+	httpServer := server.NewHttpServer(port)
+
+	tmpDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(tmpDir, "page.html"), []byte("<h1>hello</h1>"), 0o644)
+	if err != nil {
+		t.Fatalf("failed creating temp file: %v", err)
+	}
+	if err := httpServer.AddStaticRoutes("/static", tmpDir); err != nil {
+		t.Fatalf("failed adding static routes: %v", err)
+	}
+	err = httpServer.AddHandler("/stream", http.GET, handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ch := make(chan http.StreamedResponseChunk)
+		ctx.Response.Body = ch
+		go func() {
+			ch <- http.StreamedResponseChunk{Data: []byte("streamed")}
+			close(ch)
+		}()
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	err = httpServer.AddHandler("/writer", http.GET, handlers.HandlerFunc(func(ctx http.Context) error {
+		_, err := ctx.Writer.Write([]byte("written"))
+		return err
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	const request = "%s %s HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: br\r\nConnection: close\r\n\r\n"
+	get := sendRawRequest(t, port, fmt.Sprintf(request, "GET", "/static/page.html"))
+	head := sendRawRequest(t, port, fmt.Sprintf(request, "HEAD", "/static/page.html"))
+	getHead, _, _ := strings.Cut(get, "\n\n")
+	if !strings.HasSuffix(head, "\n\n") || strings.Count(head, "\n\n") != 1 {
+		t.Errorf("expected HEAD response without body, got: %q", head)
+	}
+	for _, name := range []string{"Content-Length", "Content-Type", "ETag", "Last-Modified", "Content-Encoding"} {
+		if responseHeader(head, name) != responseHeader(getHead, name) {
+			t.Errorf("expected %s of HEAD to match GET, got %q and %q", name, responseHeader(head, name), responseHeader(getHead, name))
+		}
+	}
+
+	for _, path := range []string{"/stream", "/writer", "/missing"} {
+		head = sendRawRequest(t, port, fmt.Sprintf(request, "HEAD", path))
+		if !strings.HasSuffix(head, "\n\n") || strings.Count(head, "\n\n") != 1 {
+			t.Errorf("expected HEAD response for %s without body, got: %q", path, head)
+		}
+	}
+
+	//the connection must stay usable after a HEAD response
+	response := sendRawRequest(t, port, "HEAD /static/page.html HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /writer HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if !strings.HasSuffix(response, "7\r\nwritten\r\n0\r\n\r\n") {
+		t.Errorf("expected second response on the same connection, got: %q", response)
+	}
+}
+
+func TestMethodNotAllowedAndOptions(t *testing.T) {
+	port := 8108
+	httpServer := server.NewHttpServer(port)
+
+	handler := handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = "ok"
+		return nil
+	})
+	for _, method := range []http.Method{http.GET, http.POST} {
+		if err := httpServer.AddHandler("/items", method, handler); err != nil {
+			t.Fatalf("failed setting up handler: %v", err)
+		}
+	}
+	err := httpServer.AddHandler("/custom", http.OPTIONS, handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = "custom options"
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	const request = "%s %s HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"
+	response := sendRawRequest(t, port, fmt.Sprintf(request, "DELETE", "/items"))
+	if !strings.Contains(response, "405 Method Not Allowed") || responseHeader(response, "Allow") != "GET, HEAD, POST, OPTIONS" {
+		t.Errorf("expected 405 with Allow header, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "OPTIONS", "/items"))
+	if !strings.Contains(response, "204 No Content") || responseHeader(response, "Allow") != "GET, HEAD, POST, OPTIONS" {
+		t.Errorf("expected automatic OPTIONS response, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "OPTIONS", "/custom"))
+	if !strings.Contains(response, "custom options") {
+		t.Errorf("expected registered OPTIONS handler to be used, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "OPTIONS", "*"))
+	if !strings.Contains(response, "204 No Content") || !strings.Contains(responseHeader(response, "Allow"), "DELETE") {
+		t.Errorf("expected server-wide OPTIONS response, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "GET", "*"))
+	if !strings.Contains(response, "400 Bad Request") {
+		t.Errorf("expected 400 for GET *, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "DELETE", "/missing"))
+	if !strings.Contains(response, "404 Not Found") {
+		t.Errorf("expected 404 for unknown path, got: %q", response)
+	}
+}
+
+func TestGlobalCORS(t *testing.T) {
+	port := 8109
+	httpServer := server.NewHttpServer(port)
+	httpServer.EnableCORS(handlers.CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []http.Method{http.GET, http.PUT},
+		AllowedHeaders:   []string{"X-Token"},
+		ExposedHeaders:   []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	err := httpServer.AddHandler("/api/items", http.GET, handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = "items"
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	const preflight = "OPTIONS /api/items HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nOrigin: %s\r\n" +
+		"Access-Control-Request-Method: %s\r\nAccess-Control-Request-Headers: %s\r\n\r\n"
+	response := sendRawRequest(t, port, fmt.Sprintf(preflight, "https://app.example.com", "PUT", "x-token, content-type"))
+	if !strings.Contains(response, "204 No Content") ||
+		responseHeader(response, "Access-Control-Allow-Origin") != "https://app.example.com" ||
+		responseHeader(response, "Access-Control-Allow-Methods") != "GET, PUT" ||
+		responseHeader(response, "Access-Control-Allow-Headers") != "x-token, content-type" ||
+		responseHeader(response, "Access-Control-Allow-Credentials") != "true" ||
+		responseHeader(response, "Access-Control-Max-Age") != "600" {
+		t.Errorf("expected successful preflight, got: %q", response)
+	}
+	for _, tt := range []struct{ origin, method, headers string }{
+		{"https://evil.example.com", "PUT", "x-token"},
+		{"https://app.example.com", "DELETE", "x-token"},
+		{"https://app.example.com", "PUT", "x-other"},
+	} {
+		response = sendRawRequest(t, port, fmt.Sprintf(preflight, tt.origin, tt.method, tt.headers))
+		if !strings.Contains(response, "204 No Content") || responseHeader(response, "Access-Control-Allow-Origin") != "" {
+			t.Errorf("expected preflight for %v to be rejected, got: %q", tt, response)
+		}
+	}
+
+	const request = "GET /api/items HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n%s\r\n"
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "Origin: https://shop.example.org\r\n"))
+	if !strings.Contains(response, "items") ||
+		responseHeader(response, "Access-Control-Allow-Origin") != "https://shop.example.org" ||
+		responseHeader(response, "Access-Control-Expose-Headers") != "X-Total" ||
+		responseHeader(response, "Vary") != "Origin" {
+		t.Errorf("expected CORS headers on response, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, ""))
+	if responseHeader(response, "Access-Control-Allow-Origin") != "" || responseHeader(response, "Vary") != "Origin" {
+		t.Errorf("expected no CORS headers without Origin, got: %q", response)
+	}
+
+	//preflights are only answered for routes that exist
+	response = sendRawRequest(t, port, strings.Replace(fmt.Sprintf(preflight, "https://app.example.com", "PUT", "x-token"), "/api/items", "/api/missing", 1))
+	if !strings.Contains(response, "404 Not Found") || responseHeader(response, "Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected 404 without CORS headers for preflight to missing route, got: %q", response)
+	}
+}
+
+func TestCORSOnSingleRoute(t *testing.T) {
+	port := 8110
+	httpServer := server.NewHttpServer(port)
+
+	cors := handlers.NewCORSHandler(handlers.CORSOptions{AllowedOrigins: []string{"*"}})
+	handler := handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = "public"
+		return nil
+	})
+	if err := httpServer.AddHandler("/public", http.GET, handlers.ComposeHandlers(cors, handler)); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	if err := httpServer.AddHandler("/public", http.OPTIONS, cors); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	if err := httpServer.AddHandler("/private", http.GET, handler); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	response := sendRawRequest(t, port, "OPTIONS /public HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n"+
+		"Origin: https://anywhere.test\r\nAccess-Control-Request-Method: GET\r\n\r\n")
+	if responseHeader(response, "Access-Control-Allow-Origin") != "*" || responseHeader(response, "Access-Control-Allow-Methods") == "" {
+		t.Errorf("expected successful preflight, got: %q", response)
+	}
+	const request = "GET %s HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nOrigin: https://anywhere.test\r\n\r\n"
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "/public"))
+	if responseHeader(response, "Access-Control-Allow-Origin") != "*" || responseHeader(response, "Vary") != "" {
+		t.Errorf("expected wildcard CORS header without Vary, got: %q", response)
+	}
+	response = sendRawRequest(t, port, fmt.Sprintf(request, "/private"))
+	if responseHeader(response, "Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected no CORS headers on other routes, got: %q", response)
+	}
+}
+
+func TestMiddlewareStacks(t *testing.T) {
+	port := 8111
+	httpServer := server.NewHttpServer(port)
+
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) handlers.Middleware {
+		return func(next handlers.Handler) handlers.Handler {
+			return handlers.HandlerFunc(func(ctx http.Context) error {
+				mu.Lock()
+				calls = append(calls, "before "+name)
+				mu.Unlock()
+				err := next.HandleRequest(ctx)
+				mu.Lock()
+				calls = append(calls, "after "+name)
+				mu.Unlock()
+				return err
+			})
+		}
+	}
+	requireToken := func(next handlers.Handler) handlers.Handler {
+		return handlers.HandlerFunc(func(ctx http.Context) error {
+			if ctx.Request.Headers.Get("X-Token") != "secret" {
+				ctx.Response.Status = http.StatusUnauthorized
+				ctx.Response.Body = "unauthorized"
+				return nil
+			}
+			return next.HandleRequest(ctx)
+		})
+	}
+	handler := handlers.HandlerFunc(func(ctx http.Context) error {
+		mu.Lock()
+		calls = append(calls, "handler")
+		mu.Unlock()
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = "hello from " + ctx.Request.Path
+		return nil
+	})
+
+	httpServer.Use(record("global"))
+	admin := httpServer.With(record("group"), requireToken)
+	if err := admin.AddHandler("/admin/users", http.GET, handler); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	if err := admin.With(record("nested")).AddHandler("/admin/stats", http.GET, handler); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	if err := httpServer.AddHandler("/public", http.GET, handler); err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	tests := []struct {
+		name      string
+		path      string
+		token     string
+		response  string
+		wantCalls []string
+	}{
+		{"Route without middleware", "/public", "", "hello from /public",
+			[]string{"before global", "handler", "after global"}},
+		{"Group middleware", "/admin/users", "secret", "hello from /admin/users",
+			[]string{"before global", "before group", "handler", "after group", "after global"}},
+		{"Nested group middleware", "/admin/stats", "secret", "hello from /admin/stats",
+			[]string{"before global", "before group", "before nested", "handler", "after nested", "after group", "after global"}},
+		{"Short-circuiting middleware", "/admin/stats", "wrong", "401 Unauthorized",
+			[]string{"before global", "before group", "after group", "after global"}},
+		{"Global middleware on 404", "/missing", "", "404 Not Found",
+			[]string{"before global", "after global"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			calls = nil
+			mu.Unlock()
+			response := sendRawRequest(t, port, fmt.Sprintf("GET %s HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nX-Token: %s\r\n\r\n", tt.path, tt.token))
+			if !strings.Contains(response, tt.response) || responseHeader(response, "Server") == "" {
+				t.Errorf("expected %q with common headers, got: %q", tt.response, response)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("middleware calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// decodeBody returns the body of response, undoing chunked transfer coding and the given content coding
+func decodeBody(t *testing.T, response string, encoding string) []byte {
+	_, body, ok := strings.Cut(response, "\n\n")
+	if !ok {
+		t.Fatalf("response without body: %q", response)
+	}
+	var r io.Reader = strings.NewReader(body)
+	if responseHeader(response, "Transfer-Encoding") == "chunked" {
+		r = httputil.NewChunkedReader(r)
+	}
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(r)
+	case "deflate":
+		r, err = zlib.NewReader(r)
+	case "br":
+		r = brotli.NewReader(r)
+	}
+	if err != nil {
+		t.Fatalf("failed decoding %s body: %v", encoding, err)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed decoding %s body: %v", encoding, err)
+	}
+	return decoded
+}
+
+func TestGzipAndDeflateCompression(t *testing.T) {
+	port := 8112
+	httpServer := server.NewHttpServer(port)
+
+	text := strings.Repeat("gophttp compresses text bodies. ", 64)
+	buffered := handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = text
+		ctx.Response.AddHeader(http.Header{Name: "Content-Type", Value: "text/plain"})
+		return nil
+	})
+	streamed := handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.AddHeader(http.Header{Name: "Content-Type", Value: "text/plain"})
+		ch := make(chan http.StreamedResponseChunk)
+		ctx.Response.Body = ch
+		go func() {
+			defer close(ch)
+			ch <- http.StreamedResponseChunk{Data: []byte(text[:512])}
+			time.Sleep(50 * time.Millisecond)
+			ch <- http.StreamedResponseChunk{Data: []byte(text[512:])}
+		}()
+		return nil
+	})
+	routes := []struct {
+		route   string
+		handler handlers.Handler
+	}{
+		{"/text", handlers.Chain(buffered, handlers.Compress)},
+		{"/fast", handlers.Chain(buffered, handlers.CompressWith(handlers.CompressionOptions{
+			Levels: map[handlers.CompressionAlgorithm]int{handlers.GzipCompression: gzip.HuffmanOnly},
+		}))},
+		{"/stream", handlers.Chain(streamed, handlers.Compress)},
+		{"/reader", handlers.Chain(handlers.HandlerFunc(func(ctx http.Context) error {
+			ctx.Response.Status = http.StatusOK
+			ctx.Response.AddHeader(http.Header{Name: "Content-Type", Value: "text/plain"})
+			ctx.Response.Body = http.NewSizedReader(strings.NewReader(text), int64(len(text)))
+			return nil
+		}), handlers.Compress)},
+	}
+	for _, route := range routes {
+		if err := httpServer.AddHandler(route.route, http.GET, route.handler); err != nil {
+			t.Fatalf("failed setting up handler: %v", err)
+		}
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	const request = "GET %s HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nAccept-Encoding: %s\r\n\r\n"
+	var sizes []int
+	for _, tt := range []struct{ path, encoding string }{{"/text", "gzip"}, {"/text", "deflate"}, {"/fast", "gzip"}} {
+		response := sendRawRequest(t, port, fmt.Sprintf(request, tt.path, tt.encoding))
+		if responseHeader(response, "Content-Encoding") != tt.encoding {
+			t.Errorf("%s with %s: unexpected Content-Encoding in %q", tt.path, tt.encoding, response)
+			continue
+		}
+		_, body, _ := strings.Cut(response, "\n\n")
+		if responseHeader(response, "Content-Length") != fmt.Sprint(len(body)) || len(body) >= len(text) {
+			t.Errorf("%s with %s: expected compressed body with matching Content-Length, got %q", tt.path, tt.encoding, response)
+		}
+		if got := decodeBody(t, response, tt.encoding); string(got) != text {
+			t.Errorf("%s with %s: decoded body = %q, want %q", tt.path, tt.encoding, got, text)
+		}
+		sizes = append(sizes, len(body))
+	}
+	if len(sizes) == 3 && sizes[2] <= sizes[0] {
+		t.Errorf("expected Huffman-only gzip (%d bytes) to be larger than the default level (%d bytes)", sizes[2], sizes[0])
+	}
+
+	//a streamed body is compressed chunk by chunk and stays chunked
+	response := sendRawRequest(t, port, fmt.Sprintf(request, "/stream", "gzip"))
+	if responseHeader(response, "Content-Encoding") != "gzip" || responseHeader(response, "Transfer-Encoding") != "chunked" {
+		t.Fatalf("expected chunked gzip response, got %q", response)
+	}
+	if got := decodeBody(t, response, "gzip"); string(got) != text {
+		t.Errorf("streamed body decoded to %q, want %q", got, text)
+	}
+
+	//reader bodies are compressed while they are sent instead of being read into memory first
+	for _, encoding := range []string{"gzip", "deflate"} {
+		response = sendRawRequest(t, port, fmt.Sprintf(request, "/reader", encoding))
+		if responseHeader(response, "Content-Encoding") != encoding || responseHeader(response, "Transfer-Encoding") != "chunked" ||
+			responseHeader(response, "Content-Length") != "" {
+			t.Errorf("expected chunked %s response without Content-Length, got %q", encoding, response)
+			continue
+		}
+		if got := decodeBody(t, response, encoding); string(got) != text {
+			t.Errorf("reader body decoded to %q, want %q", got, text)
+		}
+	}
+}
+
+func TestAcceptEncodingNegotiation(t *testing.T) {
+	port := 8113
+	httpServer := server.NewHttpServer(port)
+
+	text := strings.Repeat("negotiated ", 100)
+	err := httpServer.AddHandler("/text", http.GET, handlers.Chain(handlers.HandlerFunc(func(ctx http.Context) error {
+		ctx.Response.Status = http.StatusOK
+		ctx.Response.Body = text
+		ctx.Response.AddHeader(http.Header{Name: "Content-Type", Value: "text/plain"})
+		return nil
+	}), handlers.Compress))
+	if err != nil {
+		t.Fatalf("failed setting up handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	tests := []struct {
+		acceptEncoding string
+		wantStatus     string
+		wantEncoding   string
+	}{
+		{"", "200 OK", ""},
+		{"Accept-Encoding: deflate, gzip, br\r\n", "200 OK", "br"},
+		{"Accept-Encoding: br;q=0, gzip;q=0.5;foo=bar, deflate;q=0.4\r\n", "200 OK", "gzip"},
+		{"Accept-Encoding: *;q=0.3, br;q=0\r\n", "200 OK", "gzip"},
+		{"Accept-Encoding: zstd\r\n", "200 OK", ""},
+		{"Accept-Encoding: *;q=0, identity\r\n", "200 OK", ""},
+		{"Accept-Encoding: identity;q=0\r\n", "406 Not Acceptable", ""},
+		{"Accept-Encoding: gzip;q=0, *;q=0\r\n", "406 Not Acceptable", ""},
+	}
+	for _, tt := range tests {
+		response := sendRawRequest(t, port, "GET /text HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n"+tt.acceptEncoding+"\r\n")
+		if !strings.HasPrefix(response, "HTTP/1.1 "+tt.wantStatus+"\n") {
+			t.Errorf("%q: expected status %s, got %q", tt.acceptEncoding, tt.wantStatus, response)
+			continue
+		}
+		if got := responseHeader(response, "Content-Encoding"); got != tt.wantEncoding {
+			t.Errorf("%q: Content-Encoding = %q, want %q", tt.acceptEncoding, got, tt.wantEncoding)
+		}
+		if got := responseHeader(response, "Vary"); got != "Accept-Encoding" {
+			t.Errorf("%q: Vary = %q, want Accept-Encoding", tt.acceptEncoding, got)
+		}
+		if tt.wantStatus == "200 OK" && tt.wantEncoding == "" && !strings.HasSuffix(response, "\n\n"+text) {
+			t.Errorf("%q: expected uncompressed body, got %q", tt.acceptEncoding, response)
+		}
+	}
+}
+
+func TestCompressionPolicy(t *testing.T) {
+	port := 8114
+	httpServer := server.NewHttpServer(port)
+
+	text := strings.Repeat("compress me ", 50)
+	respond := func(contentType string, body string) handlers.Handler {
+		return handlers.HandlerFunc(func(ctx http.Context) error {
+			ctx.Response.Status = http.StatusOK
+			ctx.Response.Body = body
+			if contentType != "" {
+				ctx.Response.AddHeader(http.Header{Name: "Content-Type", Value: contentType})
+			}
+			return nil
+		})
+	}
+	onlyImages := &handlers.CompressionPolicy{AllowedTypes: []string{"image/*"}, DeniedTypes: []string{"image/png"}}
+	routes := []struct {
+		route   string
+		handler handlers.Handler
+	}{
+		{"/text", handlers.Chain(respond("text/html; charset=utf-8", text), handlers.Compress)},
+		{"/json", handlers.Chain(respond("application/json", text), handlers.Compress)},
+		{"/svg", handlers.Chain(respond("image/svg+xml", text), handlers.Compress)},
+		{"/png", handlers.Chain(respond("image/png", text), handlers.Compress)},
+		{"/zip", handlers.Chain(respond("application/zip", text), handlers.Compress)},
+		{"/untyped", handlers.Chain(respond("", text), handlers.Compress)},
+		{"/tiny", handlers.Chain(respond("text/plain", "tiny"), handlers.Compress)},
+		{"/events", handlers.Chain(respond("text/event-stream", text), handlers.Compress)},
+		//per-route overrides
+		{"/tiny-forced", handlers.Chain(respond("text/plain", "tiny"), handlers.CompressWith(handlers.CompressionOptions{
+			Policy: &handlers.CompressionPolicy{AllowedTypes: []string{"text/*"}},
+		}))},
+		{"/text-off", handlers.Chain(respond("text/plain", text), handlers.CompressWith(handlers.CompressionOptions{
+			Policy: &handlers.CompressionPolicy{},
+		}))},
+		{"/gif", handlers.Chain(respond("image/gif", text), handlers.CompressWith(handlers.CompressionOptions{Policy: onlyImages}))},
+		{"/png-denied", handlers.Chain(respond("image/png", text), handlers.CompressWith(handlers.CompressionOptions{Policy: onlyImages}))},
+	}
+	for _, route := range routes {
+		if err := httpServer.AddHandler(route.route, http.GET, route.handler); err != nil {
+			t.Fatalf("failed setting up handler: %v", err)
+		}
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	tests := []struct {
+		path           string
+		wantCompressed bool
+		wantVary       bool
+	}{
+		{"/text", true, true},
+		{"/json", true, true},
+		{"/svg", true, true},
+		{"/png", false, false},
+		{"/zip", false, false},
+		{"/untyped", false, true},
+		{"/tiny", false, true},
+		{"/events", false, false},
+		{"/tiny-forced", true, true},
+		{"/text-off", false, false},
+		{"/gif", true, true},
+		{"/png-denied", false, false},
+	}
+	for _, tt := range tests {
+		response := sendRawRequest(t, port, "GET "+tt.path+" HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nAccept-Encoding: gzip\r\n\r\n")
+		if compressed := responseHeader(response, "Content-Encoding") == "gzip"; compressed != tt.wantCompressed {
+			t.Errorf("%s: compressed = %v, want %v, got: %q", tt.path, compressed, tt.wantCompressed, response)
+		}
+		if vary := responseHeader(response, "Vary") == "Accept-Encoding"; vary != tt.wantVary {
+			t.Errorf("%s: Vary present = %v, want %v, got: %q", tt.path, vary, tt.wantVary, response)
+		}
+	}
+
+	//file routes use the compression options they were added with, keyed on the Content-Type the file handler computed
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte(text), 0o644); err != nil {
+		t.Fatalf("failed creating temp file: %v", err)
+	}
+	if err := httpServer.AddStaticRoutes("/default", tmpDir); err != nil {
+		t.Fatalf("failed adding static routes: %v", err)
+	}
+	if err := httpServer.AddStaticRoutesWithOptions("/uncompressed", tmpDir, handlers.CompressionOptions{Policy: &handlers.CompressionPolicy{}}); err != nil {
+		t.Fatalf("failed adding static routes: %v", err)
+	}
+	const request = "GET %s/notes.txt HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\nAccept-Encoding: gzip\r\n\r\n"
+	if response := sendRawRequest(t, port, fmt.Sprintf(request, "/default")); responseHeader(response, "Content-Encoding") != "gzip" {
+		t.Errorf("expected text file to be compressed, got: %q", response)
+	}
+	if response := sendRawRequest(t, port, fmt.Sprintf(request, "/uncompressed")); responseHeader(response, "Content-Encoding") != "" {
+		t.Errorf("expected compression to be turned off for the route, got: %q", response)
+	}
+}
+
+func TestRoutesHandlerSendsStatusLine(t *testing.T) {
+	port := 8115
+	httpServer := server.NewHttpServer(port)
+	if err := httpServer.AddRoutesHandler("/routes"); err != nil {
+		t.Fatalf("failed adding routes handler: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	for _, target := range []string{"/routes", "/routes?format=json"} {
+		response := sendRawRequest(t, port, "GET "+target+" HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+		if !strings.HasPrefix(response, "HTTP/1.1 200 OK\n") || !strings.Contains(response, "/routes") {
+			t.Errorf("%s: expected 200 OK listing, got: %q", target, response)
+		}
+	}
+}
+
+func TestDirectoryListingLinksFollowMountPrefix(t *testing.T) {
+	port := 8116
+	httpServer := server.NewHttpServer(port)
+
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "my notes.txt"), []byte("notes"), 0o644); err != nil {
+		t.Fatalf("failed creating temp file: %v", err)
+	}
+	files := server.NewRouter()
+	if err := files.AddFileRoutes(tmpDir); err != nil {
+		t.Fatalf("failed adding file routes: %v", err)
+	}
+	if err := httpServer.Mount("/files", files); err != nil {
+		t.Fatalf("failed mounting router: %v", err)
+	}
+	stop := startTestServer(t, httpServer)
+	defer stop()
+
+	dir := http.GetHttpPathForFilepath(tmpDir)
+	response := sendRawRequest(t, port, "GET "+http.EscapePath("/files"+dir)+" HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	link := http.EscapePath("/files" + dir + "/my notes.txt")
+	if !strings.Contains(response, `href="`+link+`"`) {
+		t.Fatalf("expected link %s in directory listing, got: %q", link, response)
+	}
+	response = sendRawRequest(t, port, "GET "+link+" HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if !strings.HasPrefix(response, "HTTP/1.1 200 OK") || !strings.HasSuffix(response, "notes") {
+		t.Errorf("expected link to lead to the file, got: %q", response)
+	}
+}